@@ -17,6 +17,7 @@ func NewProxyApp() *cli.App {
 
 	subCmdWithConfig := []*cli.Command{
 		Proxy,
+		Shard,
 	}
 
 	app.Commands = append(app.Commands, subCmdWithConfig...)
@@ -10,8 +10,11 @@ import (
 	"go-proxy/modules/config"
 	"go-proxy/modules/db"
 	"go-proxy/modules/log"
+	"go-proxy/modules/mirror"
 	"go-proxy/modules/proxy"
 	"go-proxy/modules/redirect"
+	"go-proxy/modules/shard"
+	"go-proxy/modules/stats"
 	"go.uber.org/zap"
 	"net"
 )
@@ -41,10 +44,22 @@ func runProxy(ctx *cli.Context) error {
 
 	log.Logger.Info("Monitoring starting up...")
 	db.MonitorServers(ctx.Context)
+	stats.Report(ctx.Context)
+	cache.MonitorBackend(ctx.Context)
+	mirror.Start(ctx.Context)
+	cache.StartSnapshots(ctx.Context, redirect.Fingerprint())
 
 	log.Logger.Info("Proxy is ready, serving")
 	serve(ctx.Context)
 
+	// the context is done on shutdown and on reload, the next run starts with the saved cache
+	if err := cache.SaveSnapshot(redirect.Fingerprint()); err != nil {
+		log.Logger.Warn("Couldn't write the cache snapshot", zap.Error(err))
+	}
+	if err := cache.Close(); err != nil {
+		log.Logger.Warn("Couldn't close the cache", zap.Error(err))
+	}
+
 	return nil
 }
 
@@ -65,6 +80,15 @@ func setup(ctx *cli.Context) error {
 
 	// build regex rules
 	redirect.BuildRules()
+	if err := redirect.ValidateRules(); err != nil {
+		return err
+	}
+
+	// warm the cache up, the snapshot needs the fingerprint of the rules
+	cache.LoadSnapshot(redirect.Fingerprint())
+
+	// build shard maps
+	shard.BuildMaps()
 
 	log.Logger.Debug("Initialization of db pools, groups and servers")
 	err := db.Init(ctx.Context)
@@ -115,7 +139,7 @@ func serve(ctx context.Context) {
 
 func handleConnection(ctx context.Context, c net.Conn, connectionId string) {
 	handler := proxy.NewProxyHandler(ctx, connectionId)
-	defer handler.ConnectionManager.ReturnConnectionsToPool()
+	defer handler.Close()
 
 	conn, err := server.NewConn(c, config.Config.Proxy.Access.User, config.Config.Proxy.Access.Password, handler)
 	if err != nil {
@@ -124,7 +148,9 @@ func handleConnection(ctx context.Context, c net.Conn, connectionId string) {
 		if err != nil {
 			return
 		}
+		return
 	}
+	handler.User = conn.GetUser()
 
 	for {
 		select {
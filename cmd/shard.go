@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"go-proxy/modules/config"
+	"go-proxy/modules/shard"
+	"strings"
+)
+
+var Shard = &cli.Command{
+	Name:        "shard",
+	Usage:       "Check shard maps",
+	Description: "Validates the configuration and prints the shard maps, with --map and --key prints the group of the key",
+	Action:      runShard,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "Load configuration from `FILE`",
+		},
+		&cli.StringFlag{
+			Name:    "map",
+			Aliases: []string{"m"},
+			Usage:   "Name of the shard map",
+		},
+		&cli.StringSliceFlag{
+			Name:    "key",
+			Aliases: []string{"k"},
+			Usage:   "Value of the sharding key, can be repeated",
+		},
+	},
+}
+
+func runShard(ctx *cli.Context) error {
+	configPath := ctx.String("config")
+	if configPath == "" {
+		return cli.Exit("config file path is required", 1)
+	}
+
+	// loading the config validates it
+	config.LoadConfig(configPath)
+	shard.BuildMaps()
+
+	out := ctx.App.Writer
+	keys := ctx.StringSlice("key")
+	if len(keys) == 0 {
+		for _, shardMap := range config.Config.Proxy.ShardMaps {
+			_, _ = fmt.Fprintln(out, describeShardMap(shardMap))
+		}
+		_, _ = fmt.Fprintf(out, "%d shard map(s) OK\n", len(config.Config.Proxy.ShardMaps))
+		return nil
+	}
+
+	shardMap, err := shard.GetMap(ctx.String("map"))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	for _, key := range keys {
+		group, err := shardMap.GroupFor(key)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		_, _ = fmt.Fprintf(out, "%s -> %s\n", key, group)
+	}
+
+	return nil
+}
+
+// describeShardMap returns the human-readable description of the shard map
+func describeShardMap(shardMap config.ShardMap) string {
+	if shardMap.Type == config.ShardMapHash {
+		return fmt.Sprintf("%s (hash): %s", shardMap.Name, strings.Join(shardMap.Groups, ", "))
+	}
+
+	ranges := make([]string, 0, len(shardMap.Ranges))
+	for _, shardRange := range shardMap.Ranges {
+		from, to := "-inf", "+inf"
+		if shardRange.From != nil {
+			from = fmt.Sprint(*shardRange.From)
+		}
+		if shardRange.To != nil {
+			to = fmt.Sprint(*shardRange.To)
+		}
+		ranges = append(ranges, fmt.Sprintf("[%s, %s) -> %s", from, to, shardRange.Group))
+	}
+
+	return fmt.Sprintf("%s (range): %s", shardMap.Name, strings.Join(ranges, ", "))
+}
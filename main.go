@@ -9,12 +9,16 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 )
 
 var (
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// stopping is set by the exit signal, the current run finishes and the app isn't restarted
+	stopping atomic.Bool
 )
 
 func main() {
@@ -48,19 +52,30 @@ func main() {
 					log.Logger.Info("Signal: SIGHUP received, reloading config.")
 					cancel()
 				case syscall.SIGTERM, syscall.SIGINT:
+					if stopping.Swap(true) {
+						log.Logger.Info("Second exit signal received, exiting immediately.", zap.String("signal", sig.String()))
+						os.Exit(1)
+					}
+					// the run saves its state (e.g. the cache snapshot) before it returns
 					log.Logger.Info("Exit signal received, exiting.", zap.String("signal", sig.String()))
 					cancel()
-					os.Exit(1)
 				}
 			}
 		}
 	}()
 
-	// cancel context when main function finishes
-	defer cancel()
+	// cancel context when main function finishes, cancel is replaced on every run
+	defer func() {
+		cancel()
+	}()
 
 	for {
 		run(app)
+
+		// the command finished on its own or on the exit signal, the app is restarted only when the config is reloaded
+		if ctx.Err() == nil || stopping.Load() {
+			return
+		}
 	}
 }
 
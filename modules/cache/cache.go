@@ -1,52 +1,96 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"go-proxy/modules/config"
 	"go-proxy/modules/log"
+	"io"
+	"time"
 )
 
-// Cache is an interface defining the main functions for a cache system.
+// Cache is an interface defining the main functions for a cache system. Every call is limited by the deadline
+// of the context, the errors mean the cache couldn't be used and the callers treat them as a miss.
 type Cache interface {
 	// Set stores a value associated with the given key in the cache
-	Set(key string, value string)
+	Set(ctx context.Context, key string, value string) error
+
+	// SetWithTTL stores a value that expires after the ttl, 0 means the value doesn't expire
+	SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error
 
 	// Get retrieves the value associated with the given key from the cache.
 	// Returns the value and a boolean indicating whether the key was found.
-	Get(key string) (string, bool)
+	Get(ctx context.Context, key string) (string, bool, error)
 
 	// Delete removes the value associated with the given key from the cache.
-	Delete(key string)
+	Delete(ctx context.Context, key string) error
 
 	// Clear removes all entries from the cache.
-	Clear()
+	Clear(ctx context.Context) error
 
 	// Has checks if a given key exists in the cache.
-	Has(key string) bool
+	Has(ctx context.Context, key string) (bool, error)
 }
 
+// RoutingKeyPrefix separates the routing decisions from the other cached values, e.g. the query results, only
+// the routing decisions are kept by the snapshots
+const RoutingKeyPrefix = "route:"
+
 var initializedCache Cache
 
+// callTimeout limits every cache call, 0 means the calls are limited only by the context of the caller
+var callTimeout time.Duration
+
+// WithTimeout returns the context of one cache call, limited by the configured cache timeout
+func WithTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if callTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, callTimeout)
+}
+
 // InitializeRedisCache initializes the Redis cache
 func InitializeRedisCache(cfg config.Redis) (Cache, error) {
 	log.Logger.Debug("Initializing Redis cache")
-	return NewRedisCache(cfg.Host, cfg.Port, cfg.Password, cfg.Database)
+	redisCache, err := NewRedisCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return instrument("redis", redisCache), nil
 }
 
 // InitializeInMemoryCache initializes the in-memory cache
 func InitializeInMemoryCache(cfg config.Memory) (Cache, error) {
 	log.Logger.Debug("Initializing memory cache")
-	return NewInMemoryCache(cfg.Capacity)
+	memoryCache, err := NewInMemoryCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return instrument("memory", memoryCache), nil
+}
+
+// InitializeTieredCache initializes the in-memory cache in front of the Redis cache
+func InitializeTieredCache(cfg config.Cache) (Cache, error) {
+	log.Logger.Debug("Initializing tiered cache")
+	tieredCache, err := NewTieredCache(cfg.Redis, cfg.Memory, cfg.Tiered)
+	if err != nil {
+		return nil, err
+	}
+	return instrument("tiered", tieredCache), nil
 }
 
 // InitCache initializes the cache based on the configuration
 func InitCache() error {
+	callTimeout = config.Config.Proxy.Cache.Timeout
+
 	var err error
 	switch config.Config.Proxy.Cache.Type {
 	case "redis":
 		initializedCache, err = InitializeRedisCache(config.Config.Proxy.Cache.Redis)
 	case "memory":
 		initializedCache, err = InitializeInMemoryCache(config.Config.Proxy.Cache.Memory)
+	case "tiered":
+		initializedCache, err = InitializeTieredCache(config.Config.Proxy.Cache)
 	default:
 		err = fmt.Errorf("unsupported cache type: %s", config.Config.Proxy.Cache.Type)
 	}
@@ -55,6 +99,29 @@ func InitCache() error {
 		return err
 	}
 
+	// the Redis backed caches fall back to memory while Redis is unreachable
+	initializedCache, err = withFallback(initializedCache, config.Config.Proxy.Cache)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close releases the connections of the initialized cache, it's called when the context of the proxy is done
+// on shutdown and on reload, the next run initializes a new cache
+func Close() error {
+	c := initializedCache
+	if fallback, ok := c.(*FallbackCache); ok {
+		c = fallback.primary
+	}
+	if instrumented, ok := c.(*instrumentedCache); ok {
+		c = instrumented.cache
+	}
+
+	if closer, ok := c.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
 
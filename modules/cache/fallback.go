@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fallbackCapacity is the capacity of the degraded mode cache when the memory capacity isn't configured
+const fallbackCapacity = 10000
+
+// maxDirtyKeys is the number of keys written in the degraded mode that are remembered, the whole Redis cache is
+// cleared on recovery when more keys were written
+const maxDirtyKeys = 10000
+
+// FallbackCache uses the Redis backed cache while Redis is reachable and switches to a local in-memory cache
+// (the degraded mode) when the health check fails. The keys written in the degraded mode are removed from Redis
+// before it's used again, so e.g. the table generations changed during the outage invalidate the results cached
+// in Redis and no stale value is read after the recovery.
+type FallbackCache struct {
+	primary   Cache
+	fallback  Cache
+	client    redis.UniversalClient // client of the primary cache, pinged by the health check
+	degraded  atomic.Bool
+	evictions redisEvictions // counters of Redis sampled by the health check
+
+	mu       sync.Mutex          // serializes the writes of the degraded mode with the recovery
+	dirty    map[string]struct{} // keys written in the degraded mode
+	dirtyAll bool                // the cache was cleared or too many keys were written in the degraded mode
+}
+
+func newFallbackCache(primary Cache, client redis.UniversalClient, memoryConfig config.Memory) (*FallbackCache, error) {
+	if memoryConfig.Capacity == 0 {
+		memoryConfig.Capacity = fallbackCapacity
+	}
+	fallback, err := NewInMemoryCache(memoryConfig)
+	if err != nil {
+		return nil, err
+	}
+	fallback.(*InMemoryCache).setName("fallback")
+
+	return &FallbackCache{
+		primary:  primary,
+		fallback: instrument("fallback", fallback),
+		client:   client,
+		dirty:    make(map[string]struct{}),
+	}, nil
+}
+
+// withFallback wraps the Redis backed cache, Redis is checked first and the cache starts in the degraded mode
+// if it's unreachable, unless Redis is required
+func withFallback(primary Cache, cfg config.Cache) (Cache, error) {
+	client := redisClient(primary)
+	if client == nil {
+		return primary, nil
+	}
+
+	c, err := newFallbackCache(primary, client, cfg.Memory)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.ping(context.Background()); err != nil {
+		if cfg.Redis.Required {
+			return nil, err
+		}
+		log.Logger.Warn("Redis is unreachable, starting with the memory cache", zap.Error(err))
+		c.degraded.Store(true)
+		stats.Inc("cache_backend_transition", "state", "degraded")
+	}
+
+	return c, nil
+}
+
+// redisClient returns the client of the Redis backed cache, nil for the other caches
+func redisClient(c Cache) redis.UniversalClient {
+	if instrumented, ok := c.(*instrumentedCache); ok {
+		c = instrumented.cache
+	}
+
+	switch backend := c.(type) {
+	case *RedisCache:
+		return backend.client
+	case *TieredCache:
+		return backend.client
+	default:
+		return nil
+	}
+}
+
+// MonitorBackend checks the health of Redis every configured interval until the context is done
+func MonitorBackend(ctx context.Context) {
+	c, ok := initializedCache.(*FallbackCache)
+	if !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.Config.Proxy.Cache.Redis.HealthCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Logger.Info("Context canceled, shutting down the cache monitoring")
+				return
+			case <-ticker.C:
+				c.check(ctx)
+			}
+		}
+	}()
+}
+
+// check pings Redis and switches the mode when its health changed
+func (c *FallbackCache) check(ctx context.Context) {
+	err := c.ping(ctx)
+	switch {
+	case err != nil && !c.degraded.Load():
+		c.degraded.Store(true)
+		log.Logger.Warn("Redis is unreachable, switching to the memory cache", zap.Error(err))
+		stats.Inc("cache_backend_transition", "state", "degraded")
+	case err == nil && c.degraded.Load():
+		if err := c.reconcile(ctx); err != nil {
+			log.Logger.Warn("Redis is reachable but the cache couldn't be reconciled, staying in the degraded mode", zap.Error(err))
+			return
+		}
+		log.Logger.Info("Redis is reachable again, switching back to the Redis cache")
+		stats.Inc("cache_backend_transition", "state", "healthy")
+	}
+
+	if err == nil {
+		c.reportEvictions(ctx)
+	}
+}
+
+// reportEvictions counts the keys evicted and expired by Redis since the previous health check
+func (c *FallbackCache) reportEvictions(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, config.Config.Proxy.Cache.Redis.HealthCheck)
+	defer cancel()
+	if err := c.evictions.report(ctx, c.client); err != nil {
+		log.Logger.Debug("Couldn't read the evictions of Redis", zap.Error(err))
+	}
+}
+
+// reconcile removes the keys written in the degraded mode from Redis and leaves the degraded mode, the writes wait
+// until it's done
+func (c *FallbackCache) reconcile(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dirtyAll {
+		if err := c.primary.Clear(ctx); err != nil {
+			return err
+		}
+	} else {
+		for key := range c.dirty {
+			if err := c.delete(ctx, key); err != nil {
+				return err
+			}
+			// the removed keys aren't removed again by the next attempt
+			delete(c.dirty, key)
+		}
+	}
+
+	c.dirty = make(map[string]struct{})
+	c.dirtyAll = false
+	c.degraded.Store(false)
+	return c.fallback.Clear(ctx)
+}
+
+func (c *FallbackCache) delete(ctx context.Context, key string) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return c.primary.Delete(ctx, key)
+}
+
+func (c *FallbackCache) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, config.Config.Proxy.Cache.Redis.HealthCheck)
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// write runs the write on the current cache, the key written in the degraded mode is remembered. A failed write
+// to Redis could have been applied or not (e.g. on a timeout), so its key is remembered too and the cache switches
+// to the degraded mode, the key is removed from Redis before it's used again.
+func (c *FallbackCache) write(key string, all bool, write func(Cache) error) error {
+	if c.degraded.Load() {
+		c.mu.Lock()
+		if c.degraded.Load() {
+			c.markDirty(key, all)
+			c.mu.Unlock()
+			return write(c.fallback)
+		}
+		c.mu.Unlock()
+	}
+
+	err := write(c.primary)
+	if err == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.markDirty(key, all)
+	if !c.degraded.Load() {
+		c.degraded.Store(true)
+		log.Logger.Warn("Redis write failed, switching to the memory cache", zap.String("key", key), zap.Error(err))
+		stats.Inc("cache_backend_transition", "state", "degraded")
+	}
+	c.mu.Unlock()
+	return write(c.fallback)
+}
+
+// markDirty remembers the key that has to be removed from Redis on recovery, it has to be called with the lock held
+func (c *FallbackCache) markDirty(key string, all bool) {
+	if all || len(c.dirty) >= maxDirtyKeys {
+		c.dirtyAll = true
+	} else {
+		c.dirty[key] = struct{}{}
+	}
+}
+
+// current returns the cache used for the reads
+func (c *FallbackCache) current() Cache {
+	if c.degraded.Load() {
+		return c.fallback
+	}
+	return c.primary
+}
+
+func (c *FallbackCache) Set(ctx context.Context, key string, value string) error {
+	return c.write(key, false, func(cache Cache) error {
+		return cache.Set(ctx, key, value)
+	})
+}
+
+func (c *FallbackCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return c.write(key, false, func(cache Cache) error {
+		return cache.SetWithTTL(ctx, key, value, ttl)
+	})
+}
+
+func (c *FallbackCache) Get(ctx context.Context, key string) (string, bool, error) {
+	return c.current().Get(ctx, key)
+}
+
+func (c *FallbackCache) Delete(ctx context.Context, key string) error {
+	return c.write(key, false, func(cache Cache) error {
+		return cache.Delete(ctx, key)
+	})
+}
+
+// Clear clears the current cache, Redis is cleared on recovery if it's unreachable
+func (c *FallbackCache) Clear(ctx context.Context) error {
+	return c.write("", true, func(cache Cache) error {
+		return cache.Clear(ctx)
+	})
+}
+
+func (c *FallbackCache) Has(ctx context.Context, key string) (bool, error) {
+	return c.current().Has(ctx, key)
+}
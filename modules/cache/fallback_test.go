@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// failingCache fails every write, like an unreachable Redis
+type failingCache struct {
+	InMemoryCache
+}
+
+func (c *failingCache) Set(context.Context, string, string) error {
+	return errors.New("i/o timeout")
+}
+
+func TestFallbackCacheFailedWrite(t *testing.T) {
+	log.Logger = zap.NewNop()
+	ctx := context.Background()
+	c, err := newFallbackCache(&failingCache{}, nil, config.Memory{Capacity: 100, Shards: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Set(ctx, "generation:t", "2"); err != nil {
+		t.Fatalf("Set = %v, want the write to go to the fallback", err)
+	}
+	if !c.degraded.Load() {
+		t.Error("cache isn't degraded after the failed write")
+	}
+	if _, dirty := c.dirty["generation:t"]; !dirty {
+		t.Error("key of the failed write isn't dirty")
+	}
+	if value, found, _ := c.Get(ctx, "generation:t"); !found || value != "2" {
+		t.Errorf("Get = %q, %v, want the value written to the fallback", value, found)
+	}
+}
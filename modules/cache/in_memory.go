@@ -1,104 +1,243 @@
 package cache
 
 import (
-	"container/list"
+	"context"
 	"fmt"
-	"go-proxy/modules/log"
+	"go-proxy/modules/config"
+	"go-proxy/modules/stats"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// entryOverhead approximates the memory used by an entry besides its key and value
+const entryOverhead = 96
+
+// InMemoryCache is sharded by the hash of the key, every shard has its own lock and evicts by the CLOCK algorithm
+// (approximate LRU), so reads take only the read lock of one shard and don't serialize.
 type InMemoryCache struct {
-	cache    map[string]*list.Element
-	lruList  *list.List
-	capacity int
-	mu       sync.Mutex // Mutex to ensure thread safety
+	shards []*cacheShard
+	seed   maphash.Seed
+	name   string // type label of the eviction metrics
+}
+
+// cacheShard keeps its entries in a ring swept by the clock hand, an entry read since the last sweep gets
+// a second chance
+type cacheShard struct {
+	mu       sync.RWMutex
+	entries  map[string]*memoryEntry
+	ring     []*memoryEntry // slots of the entries, nil if free
+	free     []int          // free slots of the ring
+	hand     int            // position of the clock hand
+	capacity int            // maximal number of the entries
+	maxBytes int64          // maximal size of the entries, 0 means unbounded
+	bytes    int64          // current size of the entries
+	name     string
 }
 
-type Entry struct {
-	key   string
-	value string
+// memoryEntry is never modified after it's stored, except for its reference bit
+type memoryEntry struct {
+	key        string
+	value      string
+	expires    int64 // unix nanoseconds, 0 if the entry doesn't expire
+	slot       int
+	referenced atomic.Bool // set by reads, cleared by the clock hand
 }
 
-func NewInMemoryCache(capacity int) (Cache, error) {
-	if capacity == 0 {
+func NewInMemoryCache(cfg config.Memory) (Cache, error) {
+	if cfg.Capacity <= 0 {
 		return nil, fmt.Errorf("NewInMemoryCache capacity can't be 0")
 	}
 
-	return &InMemoryCache{
-		cache:    make(map[string]*list.Element),
-		lruList:  list.New(),
-		capacity: capacity,
-	}, nil
+	shardCount := min(max(cfg.Shards, 1), cfg.Capacity)
+	c := &InMemoryCache{
+		shards: make([]*cacheShard, shardCount),
+		seed:   maphash.MakeSeed(),
+		name:   "memory",
+	}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			entries:  make(map[string]*memoryEntry),
+			capacity: (cfg.Capacity + shardCount - 1) / shardCount,
+			maxBytes: (cfg.MaxBytes + int64(shardCount) - 1) / int64(shardCount),
+			name:     c.name,
+		}
+	}
+
+	return c, nil
 }
 
-// Set stores a value associated with the given key in the cache.
-func (c *InMemoryCache) Set(key string, value string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Check if the key already exists
-	if elem, ok := c.cache[key]; ok {
-		c.lruList.MoveToFront(elem)
-		elem.Value.(*Entry).value = value
-	}
-
-	// If the cache is at capacity, remove the least recently used item
-	if c.lruList.Len() >= c.capacity {
-		log.Logger.Debug("LRU capacity hit, removing last item")
-		backElem := c.lruList.Back()
-		if backElem != nil {
-			c.lruList.Remove(backElem)
-			delete(c.cache, backElem.Value.(*Entry).key)
-		}
+// setName sets the type label of the eviction metrics, it has to be called before the cache is used
+func (c *InMemoryCache) setName(name string) {
+	c.name = name
+	for _, shard := range c.shards {
+		shard.name = name
 	}
+}
 
-	// Add the new entry to the front of the LRU list and to the cache map
-	entry := &Entry{
-		key:   key,
-		value: value,
+func (c *InMemoryCache) shard(key string) *cacheShard {
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+// Set stores a value associated with the given key in the cache.
+func (c *InMemoryCache) Set(ctx context.Context, key string, value string) error {
+	return c.SetWithTTL(ctx, key, value, 0)
+}
+
+// SetWithTTL stores a value that expires after the ttl, 0 means the value doesn't expire.
+func (c *InMemoryCache) SetWithTTL(_ context.Context, key string, value string, ttl time.Duration) error {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixNano()
 	}
 
-	frontElem := c.lruList.PushFront(entry)
-	c.cache[key] = frontElem
+	c.shard(key).set(&memoryEntry{key: key, value: value, expires: expires})
+	return nil
 }
 
 // Get retrieves the value associated with the given key from the cache.
-func (c *InMemoryCache) Get(key string) (string, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *InMemoryCache) Get(_ context.Context, key string) (string, bool, error) {
+	shard := c.shard(key)
+
+	shard.mu.RLock()
+	entry, found := shard.entries[key]
+	shard.mu.RUnlock()
+	if !found {
+		return "", false, nil
+	}
 
-	if elem, ok := c.cache[key]; ok {
-		c.lruList.MoveToFront(elem)
-		return elem.Value.(*Entry).value, true
+	if entry.isExpired(time.Now().UnixNano()) {
+		shard.removeExpired(entry)
+		return "", false, nil
 	}
-	return "", false
+
+	if !entry.referenced.Load() {
+		entry.referenced.Store(true)
+	}
+	return entry.value, true, nil
 }
 
 // Delete removes the value associated with the given key from the cache.
-func (c *InMemoryCache) Delete(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *InMemoryCache) Delete(_ context.Context, key string) error {
+	shard := c.shard(key)
 
-	if elem, ok := c.cache[key]; ok {
-		c.lruList.Remove(elem)
-		delete(c.cache, key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if entry, found := shard.entries[key]; found {
+		shard.remove(entry)
 	}
+	return nil
 }
 
 // Clear removes all entries from the cache.
-func (c *InMemoryCache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.cache = make(map[string]*list.Element)
-	c.lruList.Init()
+func (c *InMemoryCache) Clear(_ context.Context) error {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.entries = make(map[string]*memoryEntry)
+		shard.ring = nil
+		shard.free = nil
+		shard.hand = 0
+		shard.bytes = 0
+		shard.mu.Unlock()
+	}
+	return nil
 }
 
 // Has checks if a given key exists in the cache.
-func (c *InMemoryCache) Has(key string) bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *InMemoryCache) Has(_ context.Context, key string) (bool, error) {
+	shard := c.shard(key)
+
+	shard.mu.RLock()
+	entry, found := shard.entries[key]
+	shard.mu.RUnlock()
+
+	return found && !entry.isExpired(time.Now().UnixNano()), nil
+}
+
+// set stores the entry, replaces the entry of the same key and evicts entries until the new one fits
+func (s *cacheShard) set(entry *memoryEntry) {
+	size := entry.size()
+	if s.maxBytes > 0 && size > s.maxBytes {
+		stats.Inc("cache_eviction", "type", s.name, "reason", "size")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, found := s.entries[entry.key]; found {
+		s.remove(previous)
+	}
+
+	now := time.Now().UnixNano()
+	for len(s.entries) > 0 && (len(s.entries) >= s.capacity || (s.maxBytes > 0 && s.bytes+size > s.maxBytes)) {
+		s.evict(now)
+	}
+
+	var slot int
+	if len(s.free) > 0 {
+		slot = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+	} else {
+		slot = len(s.ring)
+		s.ring = append(s.ring, nil)
+	}
+
+	entry.slot = slot
+	s.ring[slot] = entry
+	s.entries[entry.key] = entry
+	s.bytes += size
+}
+
+// evict advances the clock hand to the first expired or not recently read entry and removes it, the lock has to
+// be held and the shard can't be empty
+func (s *cacheShard) evict(now int64) {
+	for {
+		s.hand = (s.hand + 1) % len(s.ring)
+		entry := s.ring[s.hand]
+		if entry == nil {
+			continue
+		}
+
+		if entry.isExpired(now) {
+			s.remove(entry)
+			stats.Inc("cache_eviction", "type", s.name, "reason", "expired")
+			return
+		}
+		if entry.referenced.Swap(false) {
+			continue
+		}
+
+		s.remove(entry)
+		stats.Inc("cache_eviction", "type", s.name, "reason", "capacity")
+		return
+	}
+}
+
+// removeExpired removes the expired entry found by a read, unless it was already replaced
+func (s *cacheShard) removeExpired(entry *memoryEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries[entry.key] == entry {
+		s.remove(entry)
+		stats.Inc("cache_eviction", "type", s.name, "reason", "expired")
+	}
+}
+
+// remove removes the entry, the lock has to be held
+func (s *cacheShard) remove(entry *memoryEntry) {
+	delete(s.entries, entry.key)
+	s.ring[entry.slot] = nil
+	s.free = append(s.free, entry.slot)
+	s.bytes -= entry.size()
+}
+
+func (e *memoryEntry) isExpired(now int64) bool {
+	return e.expires != 0 && now >= e.expires
+}
 
-	_, ok := c.cache[key]
-	return ok
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value) + entryOverhead)
 }
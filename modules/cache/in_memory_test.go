@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"go-proxy/modules/config"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	benchmarkCapacity = 10000
+	benchmarkKeys     = 2 * benchmarkCapacity // half of the keys don't fit, the sets evict
+	benchmarkWrites   = 10                    // percentage of the sets, the rest are gets
+)
+
+// BenchmarkInMemoryCache measures the throughput of the in-memory cache under contention, one shard is one global
+// lock. Every goroutine runs a mix of gets and sets of random keys, most of them hitting a small set of hot keys,
+// the number of the goroutines is set by -cpu.
+func BenchmarkInMemoryCache(b *testing.B) {
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("route:%016x:%d", i*7919, i)
+	}
+
+	for _, shards := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c, err := NewInMemoryCache(config.Memory{Capacity: benchmarkCapacity, Shards: shards})
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+			for _, key := range keys[:benchmarkCapacity] {
+				_ = c.Set(ctx, key, key)
+			}
+
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				random := rand.New(rand.NewSource(seed.Add(1)))
+				zipf := rand.NewZipf(random, 1.1, 1, uint64(len(keys)-1))
+				for pb.Next() {
+					key := keys[zipf.Uint64()]
+					if random.Intn(100) < benchmarkWrites {
+						_ = c.Set(ctx, key, key)
+					} else {
+						_, _, _ = c.Get(ctx, key)
+					}
+				}
+			})
+		})
+	}
+}
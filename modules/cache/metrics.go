@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go-proxy/modules/stats"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// instrumentedCache reports the hits, misses, errors and latency of the calls of the cache implementation
+type instrumentedCache struct {
+	cache Cache
+	name  string // name of the implementation, the type label of the metrics
+}
+
+// instrument wraps the cache so its calls are measured
+func instrument(name string, cache Cache) Cache {
+	return &instrumentedCache{cache: cache, name: name}
+}
+
+func (c *instrumentedCache) Set(ctx context.Context, key string, value string) error {
+	start := time.Now()
+	err := c.cache.Set(ctx, key, value)
+	c.observe("set", start, err)
+	return err
+}
+
+func (c *instrumentedCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetWithTTL(ctx, key, value, ttl)
+	c.observe("set", start, err)
+	return err
+}
+
+func (c *instrumentedCache) Get(ctx context.Context, key string) (string, bool, error) {
+	start := time.Now()
+	value, found, err := c.cache.Get(ctx, key)
+	c.observe("get", start, err)
+	if err == nil {
+		if found {
+			stats.Inc("cache_hit", "type", c.name)
+		} else {
+			stats.Inc("cache_miss", "type", c.name)
+		}
+	}
+	return value, found, err
+}
+
+func (c *instrumentedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.cache.Delete(ctx, key)
+	c.observe("delete", start, err)
+	return err
+}
+
+func (c *instrumentedCache) Clear(ctx context.Context) error {
+	start := time.Now()
+	err := c.cache.Clear(ctx)
+	c.observe("clear", start, err)
+	return err
+}
+
+func (c *instrumentedCache) Has(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	found, err := c.cache.Has(ctx, key)
+	c.observe("has", start, err)
+	return found, err
+}
+
+// observe records the latency of the call and counts its error
+func (c *instrumentedCache) observe(operation string, start time.Time, err error) {
+	stats.Observe("cache_latency", time.Since(start), "type", c.name, "op", operation)
+	if err != nil {
+		stats.Inc("cache_error", "type", c.name, "op", operation)
+	}
+}
+
+// redisEvictions counts the keys evicted and expired by Redis, Redis removes them on its own so the calls of the cache
+// don't see them. The counters of INFO stats cover the whole instance, the keys of other services sharing it too.
+type redisEvictions struct {
+	evicted int64 // evicted_keys of the previous sample
+	expired int64 // expired_keys of the previous sample
+	sampled bool  // the previous sample is the baseline of the next one
+}
+
+// report reads the counters of Redis, of every master in the cluster mode, and counts the keys removed since
+// the previous sample
+func (e *redisEvictions) report(ctx context.Context, client redis.UniversalClient) error {
+	var mu sync.Mutex
+	var evicted, expired int64
+	sample := func(ctx context.Context, node redis.Cmdable) error {
+		info, err := node.Info(ctx, "stats").Result()
+		if err != nil {
+			return err
+		}
+		nodeEvicted, evictedErr := infoCounter(info, "evicted_keys")
+		nodeExpired, expiredErr := infoCounter(info, "expired_keys")
+		if evictedErr != nil || expiredErr != nil {
+			return fmt.Errorf("invalid INFO stats: %w", errors.Join(evictedErr, expiredErr))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		evicted += nodeEvicted
+		expired += nodeExpired
+		return nil
+	}
+
+	var err error
+	if cluster, isCluster := client.(*redis.ClusterClient); isCluster {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return sample(ctx, node)
+		})
+	} else {
+		err = sample(ctx, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.add(evicted, expired)
+	return nil
+}
+
+// add counts the difference of the totals and the previous sample
+func (e *redisEvictions) add(evicted int64, expired int64) {
+	// the counters restart with the server or move to another master on a failover, the sample is a new baseline
+	if e.sampled && evicted >= e.evicted && expired >= e.expired {
+		stats.Add("cache_eviction", evicted-e.evicted, "type", "redis", "reason", "capacity")
+		stats.Add("cache_eviction", expired-e.expired, "type", "redis", "reason", "expired")
+	}
+	e.evicted, e.expired, e.sampled = evicted, expired, true
+}
+
+// infoCounter returns the value of the field of the INFO reply
+func infoCounter(info string, field string) (int64, error) {
+	for _, line := range strings.Split(info, "\n") {
+		if value, found := strings.CutPrefix(strings.TrimSpace(line), field+":"); found {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("field %s not found", field)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"go-proxy/modules/stats"
+	"testing"
+)
+
+func TestInfoCounter(t *testing.T) {
+	info := "# Stats\r\ntotal_connections_received:12\r\nexpired_keys:40\r\nexpired_stale_perc:0.00\r\nevicted_keys:7\r\n"
+
+	if value, err := infoCounter(info, "evicted_keys"); err != nil || value != 7 {
+		t.Errorf("evicted_keys = %d, %v, want 7", value, err)
+	}
+	if value, err := infoCounter(info, "expired_keys"); err != nil || value != 40 {
+		t.Errorf("expired_keys = %d, %v, want 40", value, err)
+	}
+	if _, err := infoCounter(info, "evicted_clients"); err == nil {
+		t.Error("missing field was found")
+	}
+	if _, err := infoCounter("expired_keys:x\r\n", "expired_keys"); err == nil {
+		t.Error("invalid value was parsed")
+	}
+}
+
+func TestRedisEvictions(t *testing.T) {
+	const (
+		capacity = "cache_eviction{type=redis,reason=capacity}"
+		expired  = "cache_eviction{type=redis,reason=expired}"
+	)
+	counters, _ := stats.Snapshot()
+	capacityBefore, expiredBefore := counters[capacity], counters[expired]
+
+	var e redisEvictions
+	e.add(100, 1000) // the first sample is the baseline
+	e.add(103, 1010)
+	e.add(1, 2) // the server restarted
+	e.add(4, 2)
+
+	counters, _ = stats.Snapshot()
+	if got := counters[capacity] - capacityBefore; got != 6 {
+		t.Errorf("evicted keys = %d, want 6", got)
+	}
+	if got := counters[expired] - expiredBefore; got != 10 {
+		t.Errorf("expired keys = %d, want 10", got)
+	}
+}
@@ -5,90 +5,152 @@ import (
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"go-proxy/modules/config"
 	"go-proxy/modules/log"
 	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
 )
 
+// clearBatchSize is the number of keys scanned and removed at once by Clear
+const clearBatchSize = 500
+
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
+	prefix string        // prefix of the keys, the instance can be shared with other services
+	ttl    time.Duration // expiration of the entries set without their own ttl, 0 means no expiration
 }
 
-func NewRedisCache(host string, port int, password string, database int) (Cache, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     createAddr(host, port),
-		Password: password,
-		DB:       database,
-	})
+func NewRedisCache(cfg config.Redis) (Cache, error) {
+	return newRedisCache(cfg)
+}
+
+func newRedisCache(cfg config.Redis) (*RedisCache, error) {
+	rdb, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &RedisCache{
 		client: rdb,
+		prefix: cfg.KeyPrefix,
+		ttl:    cfg.TTL,
 	}, nil
 }
 
-func (c *RedisCache) Set(key string, value string) {
-	log.Logger.Debug("Set cache", zap.String("type", "redis"), zap.String("key", key), zap.String("value", value))
-	err := c.client.Set(context.Background(), key, value, 0).Err()
-	if err != nil {
-		log.Logger.Error(
-			"Set error",
-			zap.String("type", "redis"),
-			zap.String("key", key),
-			zap.String("value", value),
-			zap.NamedError("error", err),
-		)
-	}
+func (c *RedisCache) Set(ctx context.Context, key string, value string) error {
+	return c.SetWithTTL(ctx, key, value, c.ttl)
 }
 
-func (c *RedisCache) Get(key string) (string, bool) {
-	val, err := c.client.Get(context.Background(), key).Result()
+func (c *RedisCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	log.Logger.Debug("Set cache", zap.String("type", "redis"), zap.String("key", key), zap.Duration("ttl", ttl))
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, bool, error) {
+	val, err := c.client.Get(ctx, c.prefix+key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			log.Logger.Debug("Key not found", zap.String("type", "redis"), zap.String("key", key))
-			return "", false
+			return "", false, nil
 		}
-		log.Logger.Warn("Get cache error", zap.String("type", "redis"), zap.String("key", key), zap.Error(err))
-		return "", false
+		return "", false, err
 	}
 
-	log.Logger.Debug("Get cache", zap.String("type", "redis"), zap.String("key", key), zap.String("value", val))
-	return val, true
+	log.Logger.Debug("Get cache", zap.String("type", "redis"), zap.String("key", key), zap.Int("size", len(val)))
+	return val, true, nil
 }
 
-func (c *RedisCache) Delete(key string) {
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	log.Logger.Debug("Delete cache", zap.String("type", "redis"), zap.String("key", key))
-	err := c.client.Del(context.Background(), key).Err()
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+// Clear removes the keys with the prefix of the cache, keys of other services stay untouched. In the cluster mode
+// the keys are scanned on every master.
+func (c *RedisCache) Clear(ctx context.Context) error {
+	log.Logger.Debug("Clear cache", zap.String("type", "redis"), zap.String("prefix", c.prefix))
+
+	var err error
+	removed := 0
+	if cluster, isCluster := c.client.(*redis.ClusterClient); isCluster {
+		var mu sync.Mutex
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			nodeRemoved, nodeErr := c.clearNode(ctx, node)
+			mu.Lock()
+			removed += nodeRemoved
+			mu.Unlock()
+			return nodeErr
+		})
+	} else {
+		removed, err = c.clearNode(ctx, c.client)
+	}
+
 	if err != nil {
-		log.Logger.Warn(
-			"Delete error, key: %s, reason: %v",
-			zap.String("type", "redis"),
-			zap.String("key", key),
-			zap.Error(err),
-		)
+		return fmt.Errorf("cleared %d keys: %w", removed, err)
 	}
+
+	log.Logger.Debug("Cache cleared", zap.String("type", "redis"), zap.Int("removed", removed))
+	return nil
 }
 
-func (c *RedisCache) Clear() {
-	log.Logger.Debug("Clear cache", zap.String("type", "redis"))
-	err := c.client.FlushAll(context.Background()).Err()
-	if err != nil {
-		log.Logger.Warn(
-			"Clear error",
-			zap.String("type", "redis"),
-			zap.Error(err),
-		)
+// clearNode removes the keys with the prefix from the node, the keys are unlinked one by one because in the cluster
+// mode keys of different slots can't be removed by one command
+func (c *RedisCache) clearNode(ctx context.Context, node redis.Cmdable) (int, error) {
+	pattern := escapePattern(c.prefix) + "*"
+
+	var cursor uint64
+	removed := 0
+	for {
+		keys, next, err := node.Scan(ctx, cursor, pattern, clearBatchSize).Result()
+		if err != nil {
+			return removed, err
+		}
+
+		if len(keys) > 0 {
+			pipe := node.Pipeline()
+			for _, key := range keys {
+				pipe.Unlink(ctx, key)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return removed, err
+			}
+			removed += len(keys)
+		}
+
+		if cursor = next; cursor == 0 {
+			return removed, nil
+		}
 	}
 }
 
-func (c *RedisCache) Has(key string) bool {
-	result, err := c.client.Exists(context.Background(), key).Result()
+func (c *RedisCache) Has(ctx context.Context, key string) (bool, error) {
+	result, err := c.client.Exists(ctx, c.prefix+key).Result()
 	if err != nil {
-		log.Logger.Warn("Has error", zap.Error(err))
-		return false
+		return false, err
 	}
 
-	return result > 0
+	return result > 0, nil
+}
+
+// Close closes the client and its connection pool
+func (c *RedisCache) Close() error {
+	return c.client.Close()
 }
 
 func createAddr(host string, port int) string {
 	return fmt.Sprintf("%s:%d", host, port)
 }
+
+// escapePattern escapes the glob characters of the SCAN MATCH pattern
+func escapePattern(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(`*?[]^\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// resultFormat is the version of the encoded results, results in other formats are ignored
+const resultFormat = 1
+
+// ErrInvalidResult is returned when the cached value isn't a valid encoded result
+var ErrInvalidResult = errors.New("invalid cached result")
+
+// EncodeResult encodes the text protocol result of a query. The column definitions are stored as the packets
+// sent by the server, so the whole field metadata (schema, tables, charset, type, flags, decimals) is kept,
+// the rows are stored as they were sent. The encoding uses MySQL length-encoded integers and strings:
+//
+//	format, status, warnings, column count, column definitions..., row count, rows...
+func EncodeResult(result *mysql.Result) (string, error) {
+	if result == nil || result.Resultset == nil {
+		return "", fmt.Errorf("%w: result has no rows", ErrInvalidResult)
+	}
+
+	size := 16
+	for _, row := range result.RowDatas {
+		size += len(row) + 9
+	}
+	data := make([]byte, 0, size)
+
+	data = append(data, mysql.PutLengthEncodedInt(resultFormat)...)
+	data = append(data, mysql.PutLengthEncodedInt(uint64(result.Status))...)
+	data = append(data, mysql.PutLengthEncodedInt(uint64(result.Warnings))...)
+
+	data = append(data, mysql.PutLengthEncodedInt(uint64(len(result.Fields)))...)
+	for _, field := range result.Fields {
+		data = append(data, mysql.PutLengthEncodedString(field.Dump())...)
+	}
+
+	data = append(data, mysql.PutLengthEncodedInt(uint64(len(result.RowDatas)))...)
+	for _, row := range result.RowDatas {
+		data = append(data, mysql.PutLengthEncodedString(row)...)
+	}
+
+	return string(data), nil
+}
+
+// DecodeResult decodes the result encoded by EncodeResult
+func DecodeResult(value string) (result *mysql.Result, err error) {
+	// the parsers of the client library don't check the bounds of the packets
+	defer func() {
+		if recover() != nil {
+			result, err = nil, ErrInvalidResult
+		}
+	}()
+
+	r := resultReader{data: []byte(value)}
+
+	if format := r.readInt(); r.err == nil && format != resultFormat {
+		return nil, fmt.Errorf("%w: unknown format %d", ErrInvalidResult, format)
+	}
+	status := r.readInt()
+	warnings := r.readInt()
+
+	fieldCount := r.readInt()
+	if r.err != nil || fieldCount > uint64(len(r.data)) {
+		return nil, ErrInvalidResult
+	}
+	resultset := &mysql.Resultset{
+		Fields:     make([]*mysql.Field, fieldCount),
+		FieldNames: make(map[string]int, fieldCount),
+	}
+	for i := range resultset.Fields {
+		data := r.readString()
+		if r.err != nil {
+			return nil, ErrInvalidResult
+		}
+		field, err := mysql.FieldData(data).Parse()
+		if err != nil {
+			return nil, ErrInvalidResult
+		}
+		resultset.Fields[i] = field
+		resultset.FieldNames[string(field.Name)] = i
+	}
+
+	rowCount := r.readInt()
+	if r.err != nil || rowCount > uint64(len(r.data)) {
+		return nil, ErrInvalidResult
+	}
+	resultset.RowDatas = make([]mysql.RowData, rowCount)
+	resultset.Values = make([][]mysql.FieldValue, rowCount)
+	for i := range resultset.RowDatas {
+		row := mysql.RowData(r.readString())
+		if r.err != nil || !isCompleteRow(row, len(resultset.Fields)) {
+			return nil, ErrInvalidResult
+		}
+		values, err := row.ParseText(resultset.Fields, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResult, err)
+		}
+		resultset.RowDatas[i] = row
+		resultset.Values[i] = values
+	}
+
+	if r.err != nil || len(r.data) != 0 {
+		return nil, ErrInvalidResult
+	}
+
+	return &mysql.Result{
+		Status:    uint16(status),
+		Warnings:  uint16(warnings),
+		Resultset: resultset,
+	}, nil
+}
+
+// isCompleteRow checks that the row holds exactly one value of every column, the parser of the client library reads
+// the missing values as NULL
+func isCompleteRow(row []byte, columns int) bool {
+	r := resultReader{data: row}
+	for i := 0; i < columns; i++ {
+		if len(r.data) > 0 && r.data[0] == 0xfb {
+			r.data = r.data[1:]
+			continue
+		}
+		r.readString()
+	}
+	return r.err == nil && len(r.data) == 0
+}
+
+// resultReader reads the length-encoded values, the first error stops the reading
+type resultReader struct {
+	data []byte
+	err  error
+}
+
+func (r *resultReader) readInt() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	// LengthEncodedInt doesn't check the length of the data
+	if len(r.data) == 0 || len(r.data) < lengthEncodedIntSize(r.data[0]) {
+		r.err = ErrInvalidResult
+		return 0
+	}
+
+	value, isNull, n := mysql.LengthEncodedInt(r.data)
+	if isNull {
+		r.err = ErrInvalidResult
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *resultReader) readString() []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	length := r.readInt()
+	if r.err != nil || length > uint64(len(r.data)) {
+		r.err = ErrInvalidResult
+		return nil
+	}
+	value := r.data[:length:length]
+	r.data = r.data[length:]
+	return value
+}
+
+// lengthEncodedIntSize returns the size of the length-encoded integer starting with the byte
+func lengthEncodedIntSize(first byte) int {
+	switch first {
+	case 0xfc:
+		return 3
+	case 0xfd:
+		return 4
+	case 0xfe:
+		return 9
+	default:
+		return 1
+	}
+}
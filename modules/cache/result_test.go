@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"testing"
+)
+
+// binaryCharset is the charset of the binary strings
+const binaryCharset = 63
+
+// testResult builds the text protocol result with the fields and the rows, nil values are NULL
+func testResult(fields []*mysql.Field, rows ...[][]byte) *mysql.Result {
+	resultset := &mysql.Resultset{Fields: fields, FieldNames: make(map[string]int, len(fields))}
+	for i, field := range fields {
+		resultset.FieldNames[string(field.Name)] = i
+	}
+	for _, row := range rows {
+		var data []byte
+		for _, value := range row {
+			if value == nil {
+				data = append(data, 0xfb)
+				continue
+			}
+			data = append(data, mysql.PutLengthEncodedString(value)...)
+		}
+		resultset.RowDatas = append(resultset.RowDatas, data)
+	}
+	return &mysql.Result{Status: mysql.SERVER_STATUS_AUTOCOMMIT, Warnings: 2, Resultset: resultset}
+}
+
+func testFields() []*mysql.Field {
+	return []*mysql.Field{
+		{
+			Schema: []byte("shop"), Table: []byte("o"), OrgTable: []byte("orders"), Name: []byte("id"), OrgName: []byte("id"),
+			Charset: binaryCharset, ColumnLength: 20, Type: mysql.MYSQL_TYPE_LONGLONG,
+			Flag: mysql.NOT_NULL_FLAG | mysql.PRI_KEY_FLAG | mysql.UNSIGNED_FLAG,
+		},
+		{
+			Schema: []byte("shop"), Table: []byte("o"), OrgTable: []byte("orders"), Name: []byte("note"), OrgName: []byte("note"),
+			Charset: 255, ColumnLength: 1020, Type: mysql.MYSQL_TYPE_VAR_STRING,
+		},
+		{
+			Schema: []byte("shop"), Table: []byte("o"), OrgTable: []byte("orders"), Name: []byte("digest"), OrgName: []byte("digest"),
+			Charset: binaryCharset, ColumnLength: 32, Type: mysql.MYSQL_TYPE_STRING, Flag: mysql.BINARY_FLAG,
+		},
+		{
+			Name: []byte("total"), Charset: binaryCharset, ColumnLength: 12, Type: mysql.MYSQL_TYPE_NEWDECIMAL, Decimal: 2,
+		},
+		{
+			Name: []byte("ratio"), Charset: binaryCharset, ColumnLength: 22, Type: mysql.MYSQL_TYPE_DOUBLE, Decimal: 31,
+		},
+	}
+}
+
+func TestResultRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][][]byte
+	}{
+		{"no rows", nil},
+		{"one row", [][][]byte{
+			{[]byte("1"), []byte("zażółć 🙂"), {0x00, 0xff, 0xfb, '\n'}, []byte("10.50"), []byte("0.25")},
+		}},
+		{"null values", [][][]byte{
+			{[]byte("2"), nil, nil, nil, nil},
+			{[]byte("3"), []byte(""), {}, []byte("0.00"), nil},
+		}},
+		{"long value", [][][]byte{
+			{[]byte("18446744073709551615"), bytes.Repeat([]byte("a"), 70000), bytes.Repeat([]byte{0xfe}, 300), []byte("-1.00"), []byte("-0.5")},
+		}},
+	}
+
+	for _, test := range tests {
+		result := testResult(testFields(), test.rows...)
+		encoded, err := EncodeResult(result)
+		if err != nil {
+			t.Errorf("%s: EncodeResult = %v", test.name, err)
+			continue
+		}
+		decoded, err := DecodeResult(encoded)
+		if err != nil {
+			t.Errorf("%s: DecodeResult = %v", test.name, err)
+			continue
+		}
+
+		if decoded.Status != result.Status || decoded.Warnings != result.Warnings {
+			t.Errorf("%s: status %d, warnings %d, want %d, %d", test.name, decoded.Status, decoded.Warnings, result.Status, result.Warnings)
+		}
+		compareFields(t, test.name, decoded.Fields, result.Fields)
+		for name, i := range result.FieldNames {
+			if decoded.FieldNames[name] != i {
+				t.Errorf("%s: field %s at %d, want %d", test.name, name, decoded.FieldNames[name], i)
+			}
+		}
+
+		if len(decoded.RowDatas) != len(test.rows) || len(decoded.Values) != len(test.rows) {
+			t.Errorf("%s: %d rows, %d values, want %d", test.name, len(decoded.RowDatas), len(decoded.Values), len(test.rows))
+			continue
+		}
+		for i, row := range test.rows {
+			if !bytes.Equal(decoded.RowDatas[i], result.RowDatas[i]) {
+				t.Errorf("%s: row %d = %q, want %q", test.name, i, decoded.RowDatas[i], result.RowDatas[i])
+			}
+			for j, value := range row {
+				compareValue(t, test.name, decoded, i, j, value)
+			}
+		}
+	}
+}
+
+func compareFields(t *testing.T, name string, got []*mysql.Field, want []*mysql.Field) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: %d fields, want %d", name, len(got), len(want))
+		return
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !bytes.Equal(g.Schema, w.Schema) || !bytes.Equal(g.Table, w.Table) || !bytes.Equal(g.OrgTable, w.OrgTable) ||
+			!bytes.Equal(g.Name, w.Name) || !bytes.Equal(g.OrgName, w.OrgName) {
+			t.Errorf("%s: field %d names = %s.%s(%s).%s(%s), want %s.%s(%s).%s(%s)", name, i,
+				g.Schema, g.Table, g.OrgTable, g.Name, g.OrgName, w.Schema, w.Table, w.OrgTable, w.Name, w.OrgName)
+		}
+		if g.Charset != w.Charset || g.ColumnLength != w.ColumnLength || g.Type != w.Type || g.Flag != w.Flag || g.Decimal != w.Decimal {
+			t.Errorf("%s: field %d metadata = %d/%d/%d/%d/%d, want %d/%d/%d/%d/%d", name, i,
+				g.Charset, g.ColumnLength, g.Type, g.Flag, g.Decimal, w.Charset, w.ColumnLength, w.Type, w.Flag, w.Decimal)
+		}
+	}
+}
+
+func compareValue(t *testing.T, name string, decoded *mysql.Result, row int, column int, want []byte) {
+	t.Helper()
+	got := decoded.Values[row][column]
+	switch {
+	case want == nil:
+		if got.Type != mysql.FieldValueTypeNull {
+			t.Errorf("%s: value %d/%d = %v, want NULL", name, row, column, got.Value())
+		}
+	case got.Type == mysql.FieldValueTypeString:
+		if !bytes.Equal(got.AsString(), want) {
+			t.Errorf("%s: value %d/%d = %q, want %q", name, row, column, got.AsString(), want)
+		}
+	default:
+		if got.String() != string(want) {
+			t.Errorf("%s: value %d/%d = %s, want %s", name, row, column, got.String(), want)
+		}
+	}
+}
+
+func TestEncodeResultWithoutResultset(t *testing.T) {
+	for _, result := range []*mysql.Result{nil, {AffectedRows: 1}} {
+		if _, err := EncodeResult(result); !errors.Is(err, ErrInvalidResult) {
+			t.Errorf("EncodeResult(%+v) = %v, want ErrInvalidResult", result, err)
+		}
+	}
+}
+
+func encode(t *testing.T, result *mysql.Result) string {
+	t.Helper()
+	encoded, err := EncodeResult(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestDecodeResultInvalid(t *testing.T) {
+	encoded := encode(t, testResult(testFields(), [][]byte{[]byte("1"), []byte("a"), []byte("b"), []byte("1.00"), []byte("2")}))
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"unknown format", "\x02" + encoded[1:]},
+		{"trailing data", encoded + "\x00"},
+		{"not a result", "SELECT 1"},
+		{"null count", "\x01\x00\x00\xfb"},
+		{"field count beyond data", "\x01\x00\x00\xfc\xff\xff"},
+		{"row count beyond data", encoded[:len(encoded)-22] + "\xfd\xff\xff\xff"},
+		{"row of fewer values", encode(t, testResult(testFields()[1:3], [][]byte{[]byte("a")}))},
+		{"row of more values", encode(t, testResult(testFields()[1:2], [][]byte{[]byte("a"), []byte("b")}))},
+		{"value not a number", encode(t, testResult(testFields()[:1], [][]byte{[]byte("x")}))},
+	}
+	for i := 1; i < len(encoded); i += 7 {
+		tests = append(tests, struct {
+			name  string
+			value string
+		}{"truncated", encoded[:i]})
+	}
+
+	for _, test := range tests {
+		if result, err := DecodeResult(test.value); !errors.Is(err, ErrInvalidResult) {
+			t.Errorf("%s: DecodeResult(%q) = %+v, %v, want ErrInvalidResult", test.name, test.value, result, err)
+		}
+	}
+}
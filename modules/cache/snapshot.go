@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotFormat is the version of the snapshot files, snapshots in other formats are ignored
+const snapshotFormat = 1
+
+// snapshotHeader starts the snapshot file, the entries follow it one by one
+type snapshotHeader struct {
+	Format      int
+	Fingerprint string // fingerprint of the rule set the entries were made with
+	Created     time.Time
+}
+
+type snapshotEntry struct {
+	Key     string
+	Value   string
+	Expires int64 // unix nanoseconds, 0 if the entry doesn't expire
+}
+
+// snapshotMutex serializes the periodic snapshots and the one written on shutdown
+var snapshotMutex sync.Mutex
+
+// LoadSnapshot fills the memory cache from the snapshot file written by the previous run, the snapshot is discarded
+// if it was made with a different rule set (fingerprint). A missing or invalid snapshot only means a cold cache.
+func LoadSnapshot(fingerprint string) {
+	memoryCache, path := snapshotTarget()
+	if memoryCache == nil {
+		return
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Logger.Info("No cache snapshot found", zap.String("path", path))
+		return
+	}
+	if err != nil {
+		log.Logger.Warn("Couldn't open the cache snapshot", zap.String("path", path), zap.Error(err))
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	loaded, err := memoryCache.readSnapshot(bufio.NewReader(file), fingerprint)
+	if err != nil {
+		log.Logger.Warn("Couldn't load the cache snapshot", zap.String("path", path), zap.Int("loaded", loaded), zap.Error(err))
+		return
+	}
+	log.Logger.Info("Cache snapshot loaded", zap.String("path", path), zap.Int("entries", loaded))
+}
+
+// StartSnapshots writes the snapshot of the memory cache every configured interval until the context is done
+func StartSnapshots(ctx context.Context, fingerprint string) {
+	memoryCache, _ := snapshotTarget()
+	interval := config.Config.Proxy.Cache.Memory.Snapshot.Interval
+	if memoryCache == nil || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := SaveSnapshot(fingerprint); err != nil {
+					log.Logger.Warn("Couldn't write the cache snapshot", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// SaveSnapshot writes the snapshot of the memory cache, the file is replaced atomically so a crash while writing
+// keeps the previous snapshot
+func SaveSnapshot(fingerprint string) error {
+	memoryCache, path := snapshotTarget()
+	if memoryCache == nil {
+		return nil
+	}
+
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	start := time.Now()
+	written, err := writeSnapshotFile(memoryCache, path, fingerprint)
+	if err != nil {
+		stats.Inc("cache_snapshot_error")
+		return err
+	}
+
+	stats.Observe("cache_snapshot", time.Since(start))
+	log.Logger.Debug("Cache snapshot written", zap.String("path", path), zap.Int("entries", written))
+	return nil
+}
+
+// snapshotTarget returns the memory cache and the path of its snapshot, nil if the snapshots are disabled
+func snapshotTarget() (*InMemoryCache, string) {
+	path := config.Config.Proxy.Cache.Memory.Snapshot.Path
+	if path == "" {
+		return nil, ""
+	}
+
+	c := initializedCache
+	if instrumented, ok := c.(*instrumentedCache); ok {
+		c = instrumented.cache
+	}
+	memoryCache, ok := c.(*InMemoryCache)
+	if !ok {
+		return nil, ""
+	}
+	return memoryCache, path
+}
+
+func writeSnapshotFile(memoryCache *InMemoryCache, path string, fingerprint string) (int, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// no-op after the rename
+		_ = os.Remove(file.Name())
+	}()
+
+	writer := bufio.NewWriter(file)
+	written, err := memoryCache.writeSnapshot(writer, fingerprint)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return written, os.Rename(file.Name(), path)
+}
+
+// writeSnapshot encodes the routing decisions that haven't expired, every shard is locked only while its entries
+// are collected. The cached results and the table generations aren't written, the generations restarting from
+// the snapshot couldn't invalidate the results cached before the writes made while the proxy was down.
+func (c *InMemoryCache) writeSnapshot(w io.Writer, fingerprint string) (int, error) {
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(snapshotHeader{Format: snapshotFormat, Fingerprint: fingerprint, Created: time.Now()}); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	now := time.Now().UnixNano()
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		entries := make([]*memoryEntry, 0, len(shard.entries))
+		for _, entry := range shard.entries {
+			entries = append(entries, entry)
+		}
+		shard.mu.RUnlock()
+
+		// the stored entries are never modified
+		for _, entry := range entries {
+			if entry.isExpired(now) || !strings.HasPrefix(entry.key, RoutingKeyPrefix) {
+				continue
+			}
+			if err := encoder.Encode(snapshotEntry{Key: entry.key, Value: entry.value, Expires: entry.expires}); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+
+	return written, nil
+}
+
+// readSnapshot stores the routing decisions of the snapshot that haven't expired, nothing is stored if the snapshot
+// was made with a different rule set
+func (c *InMemoryCache) readSnapshot(r io.Reader, fingerprint string) (int, error) {
+	decoder := gob.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return 0, err
+	}
+	if header.Format != snapshotFormat {
+		return 0, fmt.Errorf("unknown snapshot format %d", header.Format)
+	}
+	if header.Fingerprint != fingerprint {
+		log.Logger.Info("Cache snapshot made with different rules, discarding it",
+			zap.String("fingerprint", header.Fingerprint), zap.Time("created", header.Created))
+		return 0, nil
+	}
+
+	loaded := 0
+	for {
+		var entry snapshotEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return loaded, nil
+		}
+		if err != nil {
+			// the entries read so far are valid, the file could have been truncated
+			return loaded, err
+		}
+
+		if (entry.Expires != 0 && time.Now().UnixNano() >= entry.Expires) || !strings.HasPrefix(entry.Key, RoutingKeyPrefix) {
+			continue
+		}
+		c.shard(entry.Key).set(&memoryEntry{key: entry.Key, value: entry.Value, expires: entry.Expires})
+		loaded++
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestSnapshotKeepsOnlyRoutingDecisions(t *testing.T) {
+	log.Logger = zap.NewNop()
+	ctx := context.Background()
+	source, err := NewInMemoryCache(config.Memory{Capacity: 100, Shards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = source.Set(ctx, RoutingKeyPrefix+"fp:a", "1")
+	_ = source.SetWithTTL(ctx, RoutingKeyPrefix+"fp:b", "2", time.Hour)
+	_ = source.SetWithTTL(ctx, RoutingKeyPrefix+"fp:expired", "3", time.Nanosecond)
+	_ = source.SetWithTTL(ctx, "result:x", "rows", time.Hour)
+	_ = source.Set(ctx, "generation:t", "7")
+	time.Sleep(time.Millisecond)
+
+	var snapshot bytes.Buffer
+	written, err := source.(*InMemoryCache).writeSnapshot(&snapshot, "fp")
+	if err != nil || written != 2 {
+		t.Fatalf("writeSnapshot = %d, %v, want 2 entries", written, err)
+	}
+
+	target, _ := NewInMemoryCache(config.Memory{Capacity: 100, Shards: 4})
+	loaded, err := target.(*InMemoryCache).readSnapshot(bytes.NewReader(snapshot.Bytes()), "fp")
+	if err != nil || loaded != 2 {
+		t.Fatalf("readSnapshot = %d, %v, want 2 entries", loaded, err)
+	}
+	for key, want := range map[string]bool{
+		RoutingKeyPrefix + "fp:a": true, RoutingKeyPrefix + "fp:b": true, "result:x": false, "generation:t": false,
+	} {
+		if found, _ := target.Has(ctx, key); found != want {
+			t.Errorf("Has(%q) = %v, want %v", key, found, want)
+		}
+	}
+
+	other, _ := NewInMemoryCache(config.Memory{Capacity: 100, Shards: 4})
+	if loaded, err := other.(*InMemoryCache).readSnapshot(bytes.NewReader(snapshot.Bytes()), "other"); err != nil || loaded != 0 {
+		t.Errorf("readSnapshot with another fingerprint = %d, %v, want 0 entries", loaded, err)
+	}
+}
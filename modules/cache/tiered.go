@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clearAll is the invalidation message clearing the whole L1 cache
+const clearAll = "*"
+
+// TieredCache keeps the recently used values in memory (L1) in front of the shared Redis cache (L2). Writes go
+// to both tiers and are published to the other proxies, which remove the key from their L1. The short L1 ttl bounds
+// how long a value can be stale when an invalidation is lost, e.g. while the subscription reconnects.
+type TieredCache struct {
+	l1       Cache
+	l2       Cache
+	client   redis.UniversalClient // client of L2 publishing and receiving the invalidations
+	pubSub   *redis.PubSub         // subscription to the invalidations, closed with the cache
+	l1TTL    time.Duration
+	channel  string // pub/sub channel of the invalidations
+	instance string // id of the proxy, its own invalidations are ignored
+}
+
+func NewTieredCache(redisConfig config.Redis, memoryConfig config.Memory, tieredConfig config.Tiered) (Cache, error) {
+	l1, err := NewInMemoryCache(memoryConfig)
+	if err != nil {
+		return nil, err
+	}
+	l1.(*InMemoryCache).setName("tiered_l1")
+	l2, err := newRedisCache(redisConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &TieredCache{
+		l1:       instrument("tiered_l1", l1),
+		l2:       instrument("tiered_l2", l2),
+		client:   l2.client,
+		l1TTL:    tieredConfig.L1TTL,
+		channel:  redisConfig.KeyPrefix + tieredConfig.Channel,
+		instance: strconv.FormatUint(rand.Uint64(), 36),
+	}
+	c.pubSub = c.client.Subscribe(context.Background(), c.channel)
+	go c.subscribe(c.pubSub)
+
+	return c, nil
+}
+
+// Set stores the value in both tiers, the L1 of the other proxies is invalidated
+func (c *TieredCache) Set(ctx context.Context, key string, value string) error {
+	err := c.l2.Set(ctx, key, value)
+	_ = c.l1.SetWithTTL(ctx, key, value, c.l1TTL)
+	return errors.Join(err, c.publish(ctx, key))
+}
+
+// SetWithTTL stores the value in both tiers, L1 keeps it at most for the L1 ttl
+func (c *TieredCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	err := c.l2.SetWithTTL(ctx, key, value, ttl)
+	_ = c.l1.SetWithTTL(ctx, key, value, c.localTTL(ttl))
+	return errors.Join(err, c.publish(ctx, key))
+}
+
+// Get reads L1, then L2, the value found in L2 is kept in L1
+func (c *TieredCache) Get(ctx context.Context, key string) (string, bool, error) {
+	if value, found, _ := c.l1.Get(ctx, key); found {
+		return value, true, nil
+	}
+
+	value, found, err := c.l2.Get(ctx, key)
+	if found {
+		// the remaining ttl of the L2 entry isn't known, the L1 ttl is short
+		_ = c.l1.SetWithTTL(ctx, key, value, c.l1TTL)
+	}
+	return value, found, err
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	err := c.l2.Delete(ctx, key)
+	_ = c.l1.Delete(ctx, key)
+	return errors.Join(err, c.publish(ctx, key))
+}
+
+func (c *TieredCache) Clear(ctx context.Context) error {
+	err := c.l2.Clear(ctx)
+	_ = c.l1.Clear(ctx)
+	return errors.Join(err, c.publish(ctx, clearAll))
+}
+
+func (c *TieredCache) Has(ctx context.Context, key string) (bool, error) {
+	if found, _ := c.l1.Has(ctx, key); found {
+		return true, nil
+	}
+	return c.l2.Has(ctx, key)
+}
+
+// Close stops the subscription to the invalidations and closes the client of L2
+func (c *TieredCache) Close() error {
+	return errors.Join(c.pubSub.Close(), c.client.Close())
+}
+
+// localTTL returns the ttl of the value in L1, at most the L1 ttl
+func (c *TieredCache) localTTL(ttl time.Duration) time.Duration {
+	if ttl > 0 && ttl < c.l1TTL {
+		return ttl
+	}
+	return c.l1TTL
+}
+
+// publish sends the invalidation of the key to the other proxies
+func (c *TieredCache) publish(ctx context.Context, key string) error {
+	return c.client.Publish(ctx, c.channel, c.instance+" "+key).Err()
+}
+
+// subscribe removes the keys invalidated by the other proxies from L1, go-redis resubscribes after reconnecting.
+// It returns when the subscription is closed.
+func (c *TieredCache) subscribe(pubSub *redis.PubSub) {
+	log.Logger.Debug("Subscribed to invalidations", zap.String("type", "tiered"), zap.String("channel", c.channel))
+	ctx := context.Background()
+	for message := range pubSub.Channel() {
+		instance, key, valid := strings.Cut(message.Payload, " ")
+		if !valid {
+			log.Logger.Warn("Invalid invalidation message", zap.String("type", "tiered"), zap.String("payload", message.Payload))
+			continue
+		}
+		if instance == c.instance {
+			continue
+		}
+
+		if key == clearAll {
+			_ = c.l1.Clear(ctx)
+			continue
+		}
+		_ = c.l1.Delete(ctx, key)
+	}
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestTieredCacheClose(t *testing.T) {
+	log.Logger = zap.NewNop()
+	// nothing listens on the port, the client connects lazily and the subscription keeps retrying
+	tiered, err := NewTieredCache(
+		config.Redis{Host: "127.0.0.1", Port: 1, DialTimeout: 10 * time.Millisecond},
+		config.Memory{Capacity: 100, Shards: 1},
+		config.Tiered{L1TTL: time.Second, Channel: "invalidations"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := tiered.(*TieredCache)
+
+	initializedCache, err = newFallbackCache(instrument("tiered", c), c.client, config.Memory{Capacity: 100, Shards: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+
+	if err := c.client.Ping(context.Background()).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Errorf("Ping = %v, want the client to be closed", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// the channel read by the subscription of the cache is closed with it
+		for range c.pubSub.Channel() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("subscription wasn't closed with the cache")
+	}
+}
@@ -2,32 +2,104 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
+// MaxCachedResultSize is the size of the largest encoded result that is cached
+const MaxCachedResultSize = 1 << 20
+
+// minShardBytes is the smallest part of max_bytes a memory cache shard can get, the largest result takes at most
+// half of the shard with its key and overhead, so it's never rejected for its size
+const minShardBytes = 2 * MaxCachedResultSize
+
 type Cache struct {
-	Type   string `yaml:"type"`
-	Redis  Redis  `yaml:"redis,omitempty"`
-	Memory Memory `yaml:"memory,omitempty"`
+	Type    string        `yaml:"type"`              // redis, memory or tiered (memory in front of redis)
+	Timeout time.Duration `yaml:"timeout,omitempty"` // deadline of every cache call, the call is treated as a miss when it expires
+	Redis   Redis         `yaml:"redis,omitempty"`
+	Memory  Memory        `yaml:"memory,omitempty"`
+	Tiered  Tiered        `yaml:"tiered,omitempty"`
 }
 
+const (
+	RedisStandalone = "standalone" // single server at host:port
+	RedisSentinel   = "sentinel"   // master found by the sentinels, failover is followed automatically
+	RedisCluster    = "cluster"    // Redis Cluster, keys are spread over the nodes
+)
+
 type Redis struct {
-	Host     string `yaml:"host,omitempty"`
-	Port     int    `yaml:"port,omitempty"`
-	Password string `yaml:"password,omitempty"`
-	Database int    `yaml:"database,omitempty"`
+	Mode             string        `yaml:"mode,omitempty"` // standalone (default), sentinel or cluster
+	Host             string        `yaml:"host,omitempty"`
+	Port             int           `yaml:"port,omitempty"`
+	Addrs            []string      `yaml:"addrs,omitempty"`             // host:port of the cluster nodes, host:port is used if empty
+	MasterName       string        `yaml:"master_name,omitempty"`       // name of the master monitored by the sentinels
+	SentinelAddrs    []string      `yaml:"sentinel_addrs,omitempty"`    // host:port of the sentinels
+	SentinelUsername string        `yaml:"sentinel_username,omitempty"` // ACL user of the sentinels
+	SentinelPassword string        `yaml:"sentinel_password,omitempty"`
+	Username         string        `yaml:"username,omitempty"` // ACL user, the default user if empty
+	Password         string        `yaml:"password,omitempty"`
+	Database         int           `yaml:"database,omitempty"`
+	TLS              RedisTLS      `yaml:"tls,omitempty"`
+	PoolSize         int           `yaml:"pool_size,omitempty"`     // connections per node, go-redis default if 0
+	DialTimeout      time.Duration `yaml:"dial_timeout,omitempty"`  // go-redis default if 0
+	ReadTimeout      time.Duration `yaml:"read_timeout,omitempty"`  // go-redis default if 0
+	WriteTimeout     time.Duration `yaml:"write_timeout,omitempty"` // go-redis default if 0
+	KeyPrefix        string        `yaml:"key_prefix,omitempty"`    // prefix of every key, Clear removes only the keys with the prefix
+	TTL              time.Duration `yaml:"ttl,omitempty"`           // expiration of the entries stored without their own ttl, 0 means no expiration
+	Required         bool          `yaml:"required,omitempty"`      // the proxy doesn't start without Redis, otherwise it starts in the degraded mode
+	HealthCheck      time.Duration `yaml:"health_check,omitempty"`  // how often Redis is pinged, the memory cache is used while it's unreachable
+}
+
+// RedisTLS configures the TLS connections to Redis and to the sentinels
+type RedisTLS struct {
+	Enabled            bool   `yaml:"enabled,omitempty"`
+	CAFile             string `yaml:"ca_file,omitempty"`   // CA certificates verifying the server, system roots if empty
+	CertFile           string `yaml:"cert_file,omitempty"` // client certificate, with key_file
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"` // name verified in the server certificate, the host if empty
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 }
 
 type Memory struct {
-	Capacity int `yaml:"capacity"`
+	Capacity int            `yaml:"capacity"`            // maximal number of the entries
+	MaxBytes int64          `yaml:"max_bytes,omitempty"` // maximal approximate size of the keys and values, 0 means unbounded
+	Shards   int            `yaml:"shards,omitempty"`    // number of independently locked parts, more shards mean less contention
+	Snapshot MemorySnapshot `yaml:"snapshot,omitempty"`
+}
+
+// MemorySnapshot configures the file the memory cache is saved to and loaded from on restarts
+type MemorySnapshot struct {
+	Path     string        `yaml:"path,omitempty"`     // snapshot file, snapshots are disabled if empty
+	Interval time.Duration `yaml:"interval,omitempty"` // how often the snapshot is written while running, 0 means only on shutdown
+}
+
+// Tiered configures the in-memory L1 cache kept in front of the shared Redis L2 cache
+type Tiered struct {
+	L1TTL   time.Duration `yaml:"l1_ttl,omitempty"`  // how long a value is kept in memory, bounds the staleness if an invalidation is lost
+	Channel string        `yaml:"channel,omitempty"` // pub/sub channel of the invalidations, prefixed by the redis key_prefix
 }
 
 func GetDefaultCache() Cache {
 	return Cache{
+		Timeout: 100 * time.Millisecond,
 		Redis: Redis{
-			Host:     "127.0.0.1", // default Redis host
-			Port:     6379,        // default Redis port
-			Password: "",          // default Redis password
-			Database: 0,           // default Redis Database
+			Mode:        RedisStandalone,
+			Host:        "127.0.0.1", // default Redis host
+			Port:        6379,        // default Redis port
+			Password:    "",          // default Redis password
+			Database:    0,           // default Redis Database
+			KeyPrefix:   "go-proxy:", // default prefix of the keys
+			HealthCheck: time.Second, // default interval of the health checks
+		},
+		Memory: Memory{
+			Shards: 16,
+			Snapshot: MemorySnapshot{
+				Interval: 5 * time.Minute,
+			},
+		},
+		Tiered: Tiered{
+			L1TTL:   5 * time.Second,
+			Channel: "invalidations",
 		},
 	}
 }
@@ -37,13 +109,85 @@ func ValidateCacheConfiguration() error {
 		return errors.New("cache type is required")
 	}
 
-	if Config.Proxy.Cache.Type != "redis" && Config.Proxy.Cache.Type != "memory" {
+	if Config.Proxy.Cache.Type != "redis" && Config.Proxy.Cache.Type != "memory" && Config.Proxy.Cache.Type != "tiered" {
 		return errors.New("cache type is invalid")
 	}
 
-	if Config.Proxy.Cache.Type == "memory" && (Config.Proxy.Cache.Memory.Capacity == 0) {
+	if Config.Proxy.Cache.Timeout < 0 {
+		return errors.New("cache timeout can't be negative")
+	}
+
+	usesRedis := Config.Proxy.Cache.Type == "redis" || Config.Proxy.Cache.Type == "tiered"
+	usesMemory := Config.Proxy.Cache.Type == "memory" || Config.Proxy.Cache.Type == "tiered"
+
+	if Config.Proxy.Cache.Type == "tiered" && (Config.Proxy.Cache.Tiered.L1TTL <= 0 || Config.Proxy.Cache.Tiered.Channel == "") {
+		return errors.New("tiered cache requires l1_ttl and channel")
+	}
+
+	if usesRedis {
+		if err := validateRedis(Config.Proxy.Cache.Redis); err != nil {
+			return err
+		}
+	}
+
+	if usesRedis && Config.Proxy.Cache.Redis.KeyPrefix == "" {
+		return errors.New("redis key_prefix is required, without it the cache can't be cleared safely")
+	}
+
+	if usesRedis && Config.Proxy.Cache.Redis.TTL < 0 {
+		return errors.New("redis ttl can't be negative")
+	}
+
+	if usesRedis && Config.Proxy.Cache.Redis.HealthCheck <= 0 {
+		return errors.New("redis health_check has to be positive")
+	}
+
+	if usesMemory && (Config.Proxy.Cache.Memory.Capacity == 0) {
 		return errors.New("cache capacity is required or cannot be 0")
 	}
 
+	if usesMemory && (Config.Proxy.Cache.Memory.MaxBytes < 0 || Config.Proxy.Cache.Memory.Shards <= 0) {
+		return errors.New("cache max_bytes can't be negative and shards has to be positive")
+	}
+
+	// the bound is divided among the shards, the memory config is used by the fallback of Redis too
+	if memory := Config.Proxy.Cache.Memory; memory.MaxBytes > 0 && memory.MaxBytes < int64(max(memory.Shards, 1))*minShardBytes {
+		return fmt.Errorf("cache max_bytes has to be 0 or at least %d (2 MiB per shard)", int64(max(memory.Shards, 1))*minShardBytes)
+	}
+
+	if Config.Proxy.Cache.Memory.Snapshot.Path != "" && Config.Proxy.Cache.Type != "memory" {
+		return errors.New("cache snapshot is supported only by the memory cache type")
+	}
+
+	if Config.Proxy.Cache.Memory.Snapshot.Interval < 0 {
+		return errors.New("cache snapshot interval can't be negative")
+	}
+
+	return nil
+}
+
+func validateRedis(redis Redis) error {
+	switch redis.Mode {
+	case RedisStandalone:
+	case RedisSentinel:
+		if redis.MasterName == "" || len(redis.SentinelAddrs) == 0 {
+			return errors.New("redis sentinel mode requires master_name and sentinel_addrs")
+		}
+	case RedisCluster:
+		if redis.Database != 0 {
+			return errors.New("redis cluster mode supports only database 0")
+		}
+	default:
+		return errors.New("redis mode has to be standalone, sentinel or cluster")
+	}
+
+	if redis.PoolSize < 0 || redis.DialTimeout < 0 || redis.ReadTimeout < 0 || redis.WriteTimeout < 0 {
+		return errors.New("redis pool_size and timeouts can't be negative")
+	}
+
+	if (redis.TLS.CertFile == "") != (redis.TLS.KeyFile == "") {
+		return errors.New("redis tls cert_file and key_file have to be set together")
+	}
+
 	return nil
 }
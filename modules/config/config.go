@@ -19,20 +19,28 @@ type Configuration struct {
 
 // ProxyConfig proxy related config
 type ProxyConfig struct {
-	Basics        Basics        `yaml:"basics"`
-	Cache         Cache         `yaml:"cache,omitempty"`
-	ServerGroups  []ServerGroup `yaml:"server_groups"`
-	Servers       []Server      `yaml:"servers"`
-	DbUsers       []DbUser      `yaml:"db_users"`
-	Access        Access        `yaml:"access"`
-	Rules         []Rule        `yaml:"rules"`
+	Basics        Basics            `yaml:"basics"`
+	Cache         Cache             `yaml:"cache,omitempty"`
+	Consistency   Consistency       `yaml:"consistency,omitempty"`
+	Mirror        Mirror            `yaml:"mirror,omitempty"`
+	Hints         Hints             `yaml:"hints,omitempty"`
+	ServerGroups  []ServerGroup     `yaml:"server_groups"`
+	Servers       []Server          `yaml:"servers"`
+	DbUsers       []DbUser          `yaml:"db_users"`
+	Access        Access            `yaml:"access"`
+	Rules         []Rule            `yaml:"rules"`
+	ShardMaps     []ShardMap        `yaml:"shard_maps,omitempty"`
+	SchemaRoutes  map[string]string `yaml:"schema_routes,omitempty"` // database name to server group
 	DefaultServer *Server
 }
 
 func NewConfiguration() *Configuration {
 	return &Configuration{
 		Proxy: ProxyConfig{
-			Cache: GetDefaultCache(),
+			Cache:       GetDefaultCache(),
+			Consistency: GetDefaultConsistency(),
+			Mirror:      GetDefaultMirror(),
+			Hints:       GetDefaultHints(),
 		},
 	}
 }
@@ -64,12 +72,30 @@ func validate() []error {
 	if err := ValidateServerConfiguration(); err != nil {
 		return append(errs, err)
 	}
+	if err := ValidateServerGroupConfiguration(); err != nil {
+		return append(errs, err...)
+	}
+	if err := ValidateShardMapConfiguration(); err != nil {
+		return append(errs, err...)
+	}
+	if err := ValidateSchemaRoutesConfiguration(); err != nil {
+		return append(errs, err...)
+	}
 	if err := ValidateRuleConfiguration(); err != nil {
 		return append(errs, err...)
 	}
 	if err := ValidateCacheConfiguration(); err != nil {
 		return append(errs, err)
 	}
+	if err := ValidateConsistencyConfiguration(); err != nil {
+		return append(errs, err)
+	}
+	if err := ValidateMirrorConfiguration(); err != nil {
+		return append(errs, err)
+	}
+	if err := ValidateHintsConfiguration(); err != nil {
+		return append(errs, err)
+	}
 
 	return nil
 }
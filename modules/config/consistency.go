@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	CausalReadsOff    = "off"    // reads aren't checked against the gtid of the last write
+	CausalReadsWait   = "wait"   // replica is asked with WAIT_FOR_EXECUTED_GTID_SET
+	CausalReadsCached = "cached" // gtid_executed cached by the monitor is used
+)
+
+type Consistency struct {
+	ReadYourWrites       bool          `yaml:"read_your_writes"`        // default value of the session option
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window"` // how long reads are pinned to the write group
+	CausalReads          string        `yaml:"causal_reads"`            // off, wait or cached
+	CausalReadsTimeout   time.Duration `yaml:"causal_reads_timeout"`    // how long WAIT_FOR_EXECUTED_GTID_SET can wait
+}
+
+func GetDefaultConsistency() Consistency {
+	return Consistency{
+		ReadYourWrites:       false,
+		ReadYourWritesWindow: 2 * time.Second,
+		CausalReads:          CausalReadsOff,
+		CausalReadsTimeout:   50 * time.Millisecond,
+	}
+}
+
+func ValidateConsistencyConfiguration() error {
+	if Config.Proxy.Consistency.ReadYourWritesWindow <= 0 {
+		return errors.New("read_your_writes_window has to be greater than 0")
+	}
+
+	switch Config.Proxy.Consistency.CausalReads {
+	case CausalReadsOff, CausalReadsWait, CausalReadsCached:
+	default:
+		return errors.New("causal_reads is invalid")
+	}
+
+	if Config.Proxy.Consistency.CausalReadsTimeout <= 0 {
+		return errors.New("causal_reads_timeout has to be greater than 0")
+	}
+
+	return nil
+}
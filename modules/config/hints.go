@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"slices"
+)
+
+type Hints struct {
+	Enabled bool     `yaml:"enabled"`         // routing hints in the comments of the queries are applied
+	Users   []string `yaml:"users,omitempty"` // frontend users allowed to use the hints, every user if empty
+	Strip   bool     `yaml:"strip"`           // remove the hints before the query is sent to the server
+}
+
+func GetDefaultHints() Hints {
+	return Hints{
+		Enabled: false,
+		Strip:   false,
+	}
+}
+
+// AllowsUser checks if the frontend user can route the queries with the hints
+func (hints *Hints) AllowsUser(user string) bool {
+	return hints.Enabled && (len(hints.Users) == 0 || slices.Contains(hints.Users, user))
+}
+
+func ValidateHintsConfiguration() error {
+	for _, user := range Config.Proxy.Hints.Users {
+		if user == "" {
+			return errors.New("hints users can't be empty")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Mirror struct {
+	Group      string  `yaml:"mirror_group,omitempty"` // group receiving the copies of the queries, empty disables mirroring
+	Percentage float64 `yaml:"percentage"`             // sampled percentage of every query, the rules can mirror all their queries
+	Writes     bool    `yaml:"writes"`                 // mirror the writes too, by default only the reads are mirrored
+	QueueSize  int     `yaml:"queue_size"`             // mirrored queries waiting for execution, the rest is dropped
+	Workers    int     `yaml:"workers"`                // number of the queries executed by the mirror at once
+}
+
+func GetDefaultMirror() Mirror {
+	return Mirror{
+		Percentage: 0,
+		Writes:     false,
+		QueueSize:  1000,
+		Workers:    4,
+	}
+}
+
+// IsEnabled checks if the queries are mirrored
+func (mirror *Mirror) IsEnabled() bool {
+	return mirror.Group != ""
+}
+
+func ValidateMirrorConfiguration() error {
+	mirror := Config.Proxy.Mirror
+	if !mirror.IsEnabled() {
+		if mirror.Percentage != 0 {
+			return errors.New("mirror percentage requires mirror_group")
+		}
+		for _, rule := range Config.Proxy.Rules {
+			if rule.Mirror {
+				return fmt.Errorf("rule %v mirrors queries but mirror_group is not set", rule.Name)
+			}
+		}
+		return nil
+	}
+
+	if _, err := GetServerGroup(mirror.Group); err != nil {
+		return fmt.Errorf("mirror group %v does not exist", mirror.Group)
+	}
+	if mirror.Percentage < 0 || mirror.Percentage > 100 {
+		return errors.New("mirror percentage has to be between 0 and 100")
+	}
+	if mirror.QueueSize <= 0 {
+		return errors.New("mirror queue_size has to be greater than 0")
+	}
+	if mirror.Workers <= 0 {
+		return errors.New("mirror workers has to be greater than 0")
+	}
+
+	return nil
+}
@@ -3,13 +3,50 @@ package config
 import (
 	"errors"
 	"fmt"
+	"math"
+	"time"
 )
 
 type Rule struct {
-	Name   string `yaml:"name"`
-	Hash   string `yaml:"hash_rule,omitempty"`
-	Regex  string `yaml:"regex_rule,omitempty"`
-	Target string `yaml:"target_id"`
+	Name     string        `yaml:"name"`
+	Hash     string        `yaml:"hash_rule,omitempty"`
+	Regex    string        `yaml:"regex_rule,omitempty"`
+	Target   string        `yaml:"target_id,omitempty"`
+	Shard    *RuleShard    `yaml:"shard,omitempty"`
+	Mirror   bool          `yaml:"mirror,omitempty"`    // copy every matched query to the mirror group
+	Split    []RuleSplit   `yaml:"split,omitempty"`     // split the matched queries between the groups by percentage
+	Sticky   string        `yaml:"sticky,omitempty"`    // keep the split of the session or of the query digest
+	Timeout  time.Duration `yaml:"timeout,omitempty"`   // queries running longer are killed, 0 means no limit
+	Active   *RuleSchedule `yaml:"active,omitempty"`    // time windows when the rule is used, always if nil
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"` // results of the matched reads are cached for the duration, 0 disables
+}
+
+const (
+	StickyNone    = ""        // every query is split at random
+	StickySession = "session" // every query of the session goes to the same split
+	StickyDigest  = "digest"  // every query with the same digest goes to the same split
+)
+
+// RuleSplit sends the percentage of the queries matched by the rule to the group
+type RuleSplit struct {
+	Target     string  `yaml:"target_id"`
+	Percentage float64 `yaml:"percentage"`
+}
+
+// RuleShard routes the queries matched by the rule by the value of the sharding key
+type RuleShard struct {
+	Key string `yaml:"key"` // column compared with the key in the query
+	Map string `yaml:"map"` // name of the shard map
+}
+
+// IsResultCacheEnabled checks if any rule caches the results of its reads
+func IsResultCacheEnabled() bool {
+	for _, rule := range Config.Proxy.Rules {
+		if rule.CacheTTL > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func ValidateRuleConfiguration() []error {
@@ -18,6 +55,29 @@ func ValidateRuleConfiguration() []error {
 		if rule.Hash == "" && rule.Regex == "" {
 			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): regex_rule or hash_rule must be specified", i+1, rule.Name)))
 		}
+		if rule.Target == "" && rule.Shard == nil && len(rule.Split) == 0 {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): target_id, shard or split must be specified", i+1, rule.Name)))
+		}
+		errs = append(errs, validateRuleSplit(i, rule)...)
+		if rule.Active != nil {
+			if _, err := rule.Active.Parse(); err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): active %v", i+1, rule.Name, err)))
+			}
+		}
+		if rule.Timeout < 0 {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): timeout can't be negative", i+1, rule.Name)))
+		}
+		if rule.CacheTTL < 0 {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): cache_ttl can't be negative", i+1, rule.Name)))
+		}
+		if rule.Shard != nil {
+			if rule.Shard.Key == "" {
+				errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): shard key must be specified", i+1, rule.Name)))
+			}
+			if _, found := GetShardMap(rule.Shard.Map); !found {
+				errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): shard map %v does not exist", i+1, rule.Name, rule.Shard.Map)))
+			}
+		}
 	}
 
 	if errs == nil || len(errs) == 0 {
@@ -26,3 +86,49 @@ func ValidateRuleConfiguration() []error {
 
 	return errs
 }
+
+// Targets returns the target of the rule and the targets of its splits
+func (rule *Rule) Targets() []string {
+	targets := make([]string, 0, len(rule.Split)+1)
+	if rule.Target != "" {
+		targets = append(targets, rule.Target)
+	}
+	for _, split := range rule.Split {
+		targets = append(targets, split.Target)
+	}
+	return targets
+}
+
+// validateRuleSplit checks the split of the rule, the percentages of the splits have to add up to 100
+func validateRuleSplit(i int, rule Rule) []error {
+	errs := make([]error, 0)
+	if len(rule.Split) == 0 {
+		if rule.Sticky != StickyNone {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): sticky requires split", i+1, rule.Name)))
+		}
+		return errs
+	}
+
+	if rule.Shard != nil {
+		errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): split can't be used with shard", i+1, rule.Name)))
+	}
+	if rule.Sticky != StickyNone && rule.Sticky != StickySession && rule.Sticky != StickyDigest {
+		errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): sticky has to be %v or %v", i+1, rule.Name, StickySession, StickyDigest)))
+	}
+
+	total := 0.0
+	for _, split := range rule.Split {
+		if _, err := GetServerGroup(split.Target); err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): split group %v does not exist", i+1, rule.Name, split.Target)))
+		}
+		if split.Percentage <= 0 {
+			errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): split percentage of group %v has to be greater than 0", i+1, rule.Name, split.Target)))
+		}
+		total += split.Percentage
+	}
+	if math.Abs(total-100) > 1e-9 {
+		errs = append(errs, errors.New(fmt.Sprintf("[RULE %v ERROR] (%v): split percentages have to add up to 100", i+1, rule.Name)))
+	}
+
+	return errs
+}
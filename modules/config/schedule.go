@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minutesPerDay is the end of the window that lasts until midnight
+const minutesPerDay = 24 * 60
+
+// RuleSchedule limits the rule to the time windows, outside of them the rule doesn't match any query
+type RuleSchedule struct {
+	Timezone string           `yaml:"timezone,omitempty"` // IANA name of the timezone of the windows, UTC by default
+	Windows  []ScheduleWindow `yaml:"windows"`
+}
+
+// ScheduleWindow is the daily window of the schedule, a window ending at or before its start ends the next day
+type ScheduleWindow struct {
+	Days string `yaml:"days,omitempty"` // cron-like days of week, e.g. "mon-fri", "sat,sun" or "1-5" (0 is sunday), every day if empty
+	From string `yaml:"from,omitempty"` // HH:MM, midnight if empty
+	To   string `yaml:"to,omitempty"`   // HH:MM exclusive, midnight of the next day if empty
+}
+
+// Schedule is the parsed RuleSchedule
+type Schedule struct {
+	location *time.Location
+	windows  []window
+}
+
+type window struct {
+	days [7]bool // by time.Weekday
+	from int     // minutes since midnight
+	to   int     // minutes since midnight, the window ends the next day if to <= from
+}
+
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Parse parses the schedule
+func (s *RuleSchedule) Parse() (*Schedule, error) {
+	if len(s.Windows) == 0 {
+		return nil, fmt.Errorf("schedule requires windows")
+	}
+
+	location := time.UTC
+	if s.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("timezone %v is invalid", s.Timezone)
+		}
+	}
+
+	schedule := &Schedule{location: location}
+	for _, scheduleWindow := range s.Windows {
+		parsed, err := scheduleWindow.parse()
+		if err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, parsed)
+	}
+
+	return schedule, nil
+}
+
+func (w *ScheduleWindow) parse() (window, error) {
+	var parsed window
+	var err error
+
+	if parsed.from, err = parseClock(w.From, 0); err != nil {
+		return parsed, err
+	}
+	if parsed.to, err = parseClock(w.To, minutesPerDay); err != nil {
+		return parsed, err
+	}
+
+	if strings.TrimSpace(w.Days) == "" || strings.TrimSpace(w.Days) == "*" {
+		for day := range parsed.days {
+			parsed.days[day] = true
+		}
+		return parsed, nil
+	}
+
+	for _, part := range strings.Split(w.Days, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := parseWeekday(first)
+		if err != nil {
+			return parsed, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseWeekday(last); err != nil {
+				return parsed, err
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			parsed.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseClock parses HH:MM to minutes since midnight
+func parseClock(clock string, empty int) (int, error) {
+	if clock == "" {
+		return empty, nil
+	}
+
+	hours, minutes, found := strings.Cut(clock, ":")
+	h, hoursErr := strconv.Atoi(hours)
+	m, minutesErr := strconv.Atoi(minutes)
+	if !found || hoursErr != nil || minutesErr != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("time %v has to be in HH:MM format", clock)
+	}
+
+	return h*60 + m, nil
+}
+
+// parseWeekday parses the name or the number of the day of week, 0 and 7 are sunday
+func parseWeekday(day string) (int, error) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	if number, err := strconv.Atoi(day); err == nil && number >= 0 && number <= 7 {
+		return number % 7, nil
+	}
+	if len(day) >= 3 {
+		if number, found := weekdays[day[:3]]; found {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("day %v is invalid", day)
+}
+
+// IsActive checks if the time is within any window of the schedule
+func (s *Schedule) IsActive(t time.Time) bool {
+	t = t.In(s.location)
+	for _, w := range s.windows {
+		// the window started today or yesterday if it ends the next day
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			start, end := w.bounds(day, s.location)
+			if w.days[day.Weekday()] && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextBoundary returns the first start or end of a window after the time, the activity of the schedule can change
+// only at the boundaries
+func (s *Schedule) NextBoundary(t time.Time) time.Time {
+	local := t.In(s.location)
+	var next time.Time
+	for _, w := range s.windows {
+		for days := -1; days <= 7; days++ {
+			day := local.AddDate(0, 0, days)
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			start, end := w.bounds(day, s.location)
+			for _, boundary := range []time.Time{start, end} {
+				if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+	}
+	return next
+}
+
+// bounds returns the start and the end of the window started on the day
+func (w window) bounds(day time.Time, location *time.Location) (time.Time, time.Time) {
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, 0, w.from, 0, 0, location)
+	end := time.Date(year, month, date, 0, w.to, 0, 0, location)
+	if w.to <= w.from {
+		end = time.Date(year, month, date+1, 0, w.to, 0, 0, location)
+	}
+	return start, end
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// monday is the reference day of the tests, 2024-01-01 is a monday
+func monday(days int, clock string) time.Time {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		panic(err)
+	}
+	return time.Date(2024, 1, 1+days, parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule RuleSchedule
+	}{
+		{"no windows", RuleSchedule{}},
+		{"unknown timezone", RuleSchedule{Timezone: "Mars/Olympus", Windows: []ScheduleWindow{{}}}},
+		{"hour out of range", RuleSchedule{Windows: []ScheduleWindow{{From: "25:00"}}}},
+		{"minute out of range", RuleSchedule{Windows: []ScheduleWindow{{To: "12:60"}}}},
+		{"after midnight", RuleSchedule{Windows: []ScheduleWindow{{To: "24:01"}}}},
+		{"negative hour", RuleSchedule{Windows: []ScheduleWindow{{From: "-1:00"}}}},
+		{"missing minutes", RuleSchedule{Windows: []ScheduleWindow{{From: "12"}}}},
+		{"not a time", RuleSchedule{Windows: []ScheduleWindow{{From: "noon"}}}},
+		{"unknown day", RuleSchedule{Windows: []ScheduleWindow{{Days: "mon,xyz"}}}},
+		{"day number out of range", RuleSchedule{Windows: []ScheduleWindow{{Days: "8"}}}},
+		{"range without end", RuleSchedule{Windows: []ScheduleWindow{{Days: "mon-"}}}},
+		{"empty day in list", RuleSchedule{Windows: []ScheduleWindow{{Days: "mon,,fri"}}}},
+		{"second window invalid", RuleSchedule{Windows: []ScheduleWindow{{}, {From: "7:5x"}}}},
+	}
+
+	for _, test := range tests {
+		if _, err := test.schedule.Parse(); err == nil {
+			t.Errorf("%s: Parse(%+v) succeeded, want an error", test.name, test.schedule)
+		}
+	}
+}
+
+func TestParseScheduleDays(t *testing.T) {
+	tests := []struct {
+		days string
+		want [7]bool // by time.Weekday
+	}{
+		{"", [7]bool{true, true, true, true, true, true, true}},
+		{"*", [7]bool{true, true, true, true, true, true, true}},
+		{"mon-fri", [7]bool{false, true, true, true, true, true, false}},
+		{"1-5", [7]bool{false, true, true, true, true, true, false}},
+		{"sat,sun", [7]bool{true, false, false, false, false, false, true}},
+		{"fri-mon", [7]bool{true, true, false, false, false, true, true}},
+		{"sat-sun", [7]bool{true, false, false, false, false, false, true}},
+		{"6-0", [7]bool{true, false, false, false, false, false, true}},
+		{"7", [7]bool{true, false, false, false, false, false, false}},
+		{"0", [7]bool{true, false, false, false, false, false, false}},
+		{"Monday, WED", [7]bool{false, true, false, true, false, false, false}},
+		{"wed-wed", [7]bool{false, false, false, true, false, false, false}},
+	}
+
+	for _, test := range tests {
+		schedule, err := (&RuleSchedule{Windows: []ScheduleWindow{{Days: test.days}}}).Parse()
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", test.days, err)
+			continue
+		}
+		if got := schedule.windows[0].days; got != test.want {
+			t.Errorf("Parse(%q) days = %v, want %v", test.days, got, test.want)
+		}
+	}
+}
+
+func TestScheduleIsActive(t *testing.T) {
+	tests := []struct {
+		name   string
+		window ScheduleWindow
+		at     time.Time
+		want   bool
+	}{
+		{"whole day", ScheduleWindow{}, monday(0, "00:00"), true},
+		{"whole day end", ScheduleWindow{}, monday(0, "23:59"), true},
+		{"at start", ScheduleWindow{From: "09:00", To: "17:00"}, monday(0, "09:00"), true},
+		{"before start", ScheduleWindow{From: "09:00", To: "17:00"}, monday(0, "08:59"), false},
+		{"end is exclusive", ScheduleWindow{From: "09:00", To: "17:00"}, monday(0, "17:00"), false},
+		{"until midnight", ScheduleWindow{From: "22:00", To: "24:00"}, monday(0, "23:59"), true},
+		{"until midnight next day", ScheduleWindow{Days: "mon", From: "22:00", To: "24:00"}, monday(1, "00:00"), false},
+		{"overnight evening", ScheduleWindow{Days: "mon", From: "22:00", To: "06:00"}, monday(0, "23:00"), true},
+		{"overnight next morning", ScheduleWindow{Days: "mon", From: "22:00", To: "06:00"}, monday(1, "05:59"), true},
+		{"overnight end", ScheduleWindow{Days: "mon", From: "22:00", To: "06:00"}, monday(1, "06:00"), false},
+		{"overnight previous morning", ScheduleWindow{Days: "mon", From: "22:00", To: "06:00"}, monday(0, "05:00"), false},
+		{"overnight other day", ScheduleWindow{Days: "mon", From: "22:00", To: "06:00"}, monday(1, "23:00"), false},
+		{"overnight saturday into sunday", ScheduleWindow{Days: "sat", From: "20:00", To: "04:00"}, monday(6, "03:00"), true},
+		{"overnight sunday into monday", ScheduleWindow{Days: "sun", From: "20:00", To: "04:00"}, monday(0, "03:00"), true},
+		{"same start and end lasts a day", ScheduleWindow{Days: "mon", From: "12:00", To: "12:00"}, monday(1, "11:59"), true},
+		{"wrapped days sunday", ScheduleWindow{Days: "fri-mon"}, monday(6, "12:00"), true},
+		{"wrapped days monday", ScheduleWindow{Days: "fri-mon"}, monday(0, "12:00"), true},
+		{"wrapped days tuesday", ScheduleWindow{Days: "fri-mon"}, monday(1, "12:00"), false},
+		{"weekend on friday", ScheduleWindow{Days: "sat,sun"}, monday(4, "23:59"), false},
+		{"weekend on saturday", ScheduleWindow{Days: "sat,sun"}, monday(5, "00:00"), true},
+		{"weekend on next monday", ScheduleWindow{Days: "sat,sun"}, monday(7, "00:00"), false},
+	}
+
+	for _, test := range tests {
+		schedule, err := (&RuleSchedule{Windows: []ScheduleWindow{test.window}}).Parse()
+		if err != nil {
+			t.Errorf("%s: Parse = %v", test.name, err)
+			continue
+		}
+		if got := schedule.IsActive(test.at); got != test.want {
+			t.Errorf("%s: IsActive(%v) = %v, want %v", test.name, test.at, got, test.want)
+		}
+	}
+}
+
+func TestScheduleIsActiveTimezone(t *testing.T) {
+	schedule, err := (&RuleSchedule{
+		Timezone: "America/New_York",
+		Windows:  []ScheduleWindow{{Days: "mon", From: "09:00", To: "17:00"}},
+	}).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 09:00 in New York is 14:00 UTC in january
+	if schedule.IsActive(monday(0, "13:59")) {
+		t.Error("schedule is active before the window in its timezone")
+	}
+	if !schedule.IsActive(monday(0, "14:00")) {
+		t.Error("schedule isn't active at the start of the window in its timezone")
+	}
+	// 17:00 in New York is 22:00 UTC
+	if !schedule.IsActive(monday(0, "21:59")) || schedule.IsActive(monday(0, "22:00")) {
+		t.Error("window doesn't end at 17:00 in its timezone")
+	}
+}
+
+func TestScheduleNextBoundary(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []ScheduleWindow
+		at      time.Time
+		want    time.Time
+	}{
+		{"start later today", []ScheduleWindow{{Days: "mon", From: "22:00", To: "06:00"}}, monday(0, "12:00"), monday(0, "22:00")},
+		{"end of overnight window", []ScheduleWindow{{Days: "mon", From: "22:00", To: "06:00"}}, monday(0, "23:00"), monday(1, "06:00")},
+		{"at start", []ScheduleWindow{{Days: "mon", From: "22:00", To: "06:00"}}, monday(0, "22:00"), monday(1, "06:00")},
+		{"start next week", []ScheduleWindow{{Days: "mon", From: "22:00", To: "06:00"}}, monday(1, "07:00"), monday(7, "22:00")},
+		{"end at midnight", []ScheduleWindow{{Days: "mon", From: "22:00"}}, monday(0, "22:30"), monday(1, "00:00")},
+		{"whole day", []ScheduleWindow{{}}, monday(0, "12:00"), monday(1, "00:00")},
+		{"weekend from friday", []ScheduleWindow{{Days: "sat,sun"}}, monday(4, "12:00"), monday(5, "00:00")},
+		{"weekend from sunday", []ScheduleWindow{{Days: "sat,sun"}}, monday(6, "12:00"), monday(7, "00:00")},
+		{"wrapped days", []ScheduleWindow{{Days: "fri-mon", From: "09:00", To: "10:00"}}, monday(0, "10:00"), monday(4, "09:00")},
+		{
+			"first of the windows",
+			[]ScheduleWindow{{Days: "tue", From: "08:00", To: "09:00"}, {Days: "mon", From: "18:00", To: "20:00"}},
+			monday(0, "12:00"),
+			monday(0, "18:00"),
+		},
+	}
+
+	for _, test := range tests {
+		schedule, err := (&RuleSchedule{Windows: test.windows}).Parse()
+		if err != nil {
+			t.Errorf("%s: Parse = %v", test.name, err)
+			continue
+		}
+		if got := schedule.NextBoundary(test.at); !got.Equal(test.want) {
+			t.Errorf("%s: NextBoundary(%v) = %v, want %v", test.name, test.at, got, test.want)
+		}
+	}
+}
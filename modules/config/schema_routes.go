@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetSchemaRoute returns the group of the database, the database name can be quoted as in the USE statement
+func GetSchemaRoute(dbName string) (string, bool) {
+	dbName = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(dbName), ";"))
+	dbName = strings.Trim(dbName, "`")
+
+	group, found := Config.Proxy.SchemaRoutes[dbName]
+	return group, found
+}
+
+func ValidateSchemaRoutesConfiguration() []error {
+	errs := make([]error, 0)
+	for schema, groupId := range Config.Proxy.SchemaRoutes {
+		group, err := GetServerGroup(groupId)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[SCHEMA ROUTE %v ERROR]: group %v does not exist", schema, groupId))
+			continue
+		}
+		// every unmatched query of the session goes to the group, including the writes and transactions
+		if group.IsReplica() {
+			errs = append(errs, fmt.Errorf("[SCHEMA ROUTE %v ERROR]: group %v has to be a primary group", schema, groupId))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
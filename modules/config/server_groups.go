@@ -1,6 +1,104 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	GroupTypePrimary = "P" // group of primary servers, can execute writes
+	GroupTypeReplica = "R" // group of replicas, can execute reads only
+)
+
+const (
+	LagSourceReplicaStatus = "replica_status" // lag is read from SHOW REPLICA STATUS
+	LagSourceHeartbeat     = "heartbeat"      // lag is read from a heartbeat table (pt-heartbeat compatible)
+)
+
 type ServerGroup struct {
-	Id   string `yaml:"id"`
-	Type string `yaml:"type"`
+	Id                string        `yaml:"id"`
+	Type              string        `yaml:"type"`
+	MaxReplicationLag time.Duration `yaml:"max_replication_lag,omitempty"` // 0 disables the lag checks
+	LagSource         string        `yaml:"lag_source,omitempty"`
+	HeartbeatTable    string        `yaml:"heartbeat_table,omitempty"`
+	Fallback          []string      `yaml:"fallback,omitempty"`    // groups used in order when the group has no operational server
+	FailClosed        bool          `yaml:"fail_closed,omitempty"` // return an error instead of using the default server
+}
+
+// IsReplica checks if the group consists of replicas
+func (group *ServerGroup) IsReplica() bool {
+	return group.Type == GroupTypeReplica
+}
+
+// GetLagSource returns the configured lag source, replica status is used by default
+func (group *ServerGroup) GetLagSource() string {
+	if group.LagSource == "" {
+		return LagSourceReplicaStatus
+	}
+	return group.LagSource
+}
+
+func ValidateServerGroupConfiguration() []error {
+	errs := make([]error, 0)
+	for _, group := range Config.Proxy.ServerGroups {
+		if group.Type != GroupTypePrimary && group.Type != GroupTypeReplica {
+			errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: type has to be %v or %v", group.Id, GroupTypePrimary, GroupTypeReplica))
+		}
+
+		if group.MaxReplicationLag < 0 {
+			errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: max_replication_lag cannot be negative", group.Id))
+		}
+
+		switch group.GetLagSource() {
+		case LagSourceReplicaStatus:
+		case LagSourceHeartbeat:
+			if group.HeartbeatTable == "" {
+				errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: heartbeat_table is required when lag_source is heartbeat", group.Id))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: lag_source is invalid", group.Id))
+		}
+
+		for _, fallbackId := range group.Fallback {
+			fallback, err := GetServerGroup(fallbackId)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: fallback group %v does not exist", group.Id, fallbackId))
+				continue
+			}
+			if fallback.Id == group.Id {
+				errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: group can't be its own fallback", group.Id))
+			}
+			if !group.IsReplica() && fallback.IsReplica() {
+				errs = append(errs, fmt.Errorf("[GROUP %v ERROR]: primary group can't fall back to the replica group %v", group.Id, fallback.Id))
+			}
+		}
+	}
+
+	for _, server := range Config.Proxy.Servers {
+		if !server.Default {
+			continue
+		}
+		if group, err := GetServerGroup(server.ServerGroup); err == nil && group.IsReplica() {
+			errs = append(errs, fmt.Errorf("[SERVER %v ERROR]: default server can't belong to the replica group %v", server.Id, group.Id))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// GetServerGroup returns the configuration of the group with the given id
+func GetServerGroup(id string) (ServerGroup, error) {
+	for _, group := range Config.Proxy.ServerGroups {
+		if group.Id == id {
+			return group, nil
+		}
+	}
+	return ServerGroup{}, ErrGroupNotFound
 }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	ShardMapHash  = "hash"  // group is chosen by the hash of the key modulo the number of groups
+	ShardMapRange = "range" // group is chosen by the numeric range the key belongs to
+)
+
+type ShardMap struct {
+	Name   string       `yaml:"name"`
+	Type   string       `yaml:"type"`
+	Groups []string     `yaml:"groups,omitempty"` // used by the hash maps
+	Ranges []ShardRange `yaml:"ranges,omitempty"` // used by the range maps
+}
+
+// ShardRange keys from From (inclusive) to To (exclusive) belong to the Group, missing bound means no limit
+type ShardRange struct {
+	From  *int64 `yaml:"from,omitempty"`
+	To    *int64 `yaml:"to,omitempty"`
+	Group string `yaml:"group"`
+}
+
+// Contains checks if the key belongs to the range
+func (shardRange *ShardRange) Contains(key int64) bool {
+	if shardRange.From != nil && key < *shardRange.From {
+		return false
+	}
+	if shardRange.To != nil && key >= *shardRange.To {
+		return false
+	}
+	return true
+}
+
+// GetShardMap returns the shard map with the given name
+func GetShardMap(name string) (ShardMap, bool) {
+	for _, shardMap := range Config.Proxy.ShardMaps {
+		if shardMap.Name == name {
+			return shardMap, true
+		}
+	}
+	return ShardMap{}, false
+}
+
+func ValidateShardMapConfiguration() []error {
+	errs := make([]error, 0)
+	names := make(map[string]bool)
+	for _, shardMap := range Config.Proxy.ShardMaps {
+		if shardMap.Name == "" {
+			errs = append(errs, fmt.Errorf("[SHARD MAP ERROR]: name is required"))
+			continue
+		}
+		if names[shardMap.Name] {
+			errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: name has to be unique", shardMap.Name))
+		}
+		names[shardMap.Name] = true
+
+		switch shardMap.Type {
+		case ShardMapHash:
+			if len(shardMap.Groups) == 0 {
+				errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: hash map requires groups", shardMap.Name))
+			}
+			for _, group := range shardMap.Groups {
+				if _, err := GetServerGroup(group); err != nil {
+					errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: group %v does not exist", shardMap.Name, group))
+				}
+			}
+		case ShardMapRange:
+			errs = append(errs, validateShardRanges(shardMap)...)
+		default:
+			errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: type has to be %v or %v", shardMap.Name, ShardMapHash, ShardMapRange))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// validateShardRanges checks that the ranges are correct and don't overlap
+func validateShardRanges(shardMap ShardMap) []error {
+	errs := make([]error, 0)
+	if len(shardMap.Ranges) == 0 {
+		return append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: range map requires ranges", shardMap.Name))
+	}
+
+	for _, shardRange := range shardMap.Ranges {
+		if _, err := GetServerGroup(shardRange.Group); err != nil {
+			errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: group %v does not exist", shardMap.Name, shardRange.Group))
+		}
+		if shardRange.From != nil && shardRange.To != nil && *shardRange.From >= *shardRange.To {
+			errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: range of group %v is empty", shardMap.Name, shardRange.Group))
+		}
+	}
+
+	ranges := make([]ShardRange, len(shardMap.Ranges))
+	copy(ranges, shardMap.Ranges)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From == nil || (ranges[j].From != nil && *ranges[i].From < *ranges[j].From)
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i-1].To == nil || ranges[i].From == nil || *ranges[i-1].To > *ranges[i].From {
+			errs = append(errs, fmt.Errorf("[SHARD MAP %v ERROR]: ranges of groups %v and %v overlap", shardMap.Name, ranges[i-1].Group, ranges[i].Group))
+		}
+	}
+
+	return errs
+}
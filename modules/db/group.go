@@ -1,17 +1,22 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"go-proxy/modules/config"
 	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
 	"go.uber.org/zap"
 	"math/rand"
+	"sync/atomic"
 )
 
 type Group struct {
 	Id        string
+	Config    config.ServerGroup
 	servers   map[string]*Server
-	serverIds []string // used for randomized getter
+	serverIds []string     // used for randomized getter
+	fallback  atomic.Value // string, the fallback serving the group, empty while the group has an operational server
 }
 
 var (
@@ -32,15 +37,16 @@ func LoadGroups() error {
 		if groupFound {
 			return fmt.Errorf("group %s already exists", group.Id)
 		}
-		Groups[group.Id] = NewGroup(group.Id) // what about the type?
+		Groups[group.Id] = NewGroup(group)
 	}
 
 	return nil
 }
 
-func NewGroup(id string) *Group {
+func NewGroup(group config.ServerGroup) *Group {
 	return &Group{
-		Id:        id,
+		Id:        group.Id,
+		Config:    group,
 		servers:   make(map[string]*Server),
 		serverIds: make([]string, 0),
 	}
@@ -57,13 +63,69 @@ func (g *Group) AddServer(server *Server) {
 	log.Logger.Debug("New server added, group", zap.String("group", server.Config.Id))
 }
 
+var ErrNoServerAvailable = errors.New("no operational server available")
+
+// GetRandomServer returns random operational server of the group, when there is none (e.g. every replica is lagging)
+// then the fallback groups are checked in order, at the end the default server is used unless the group fails closed
 func (g *Group) GetRandomServer() (*Server, error) {
 	log.Logger.Debug("Looking for random server")
-	if len(g.serverIds) == 0 {
-		log.Logger.Debug("No servers found in group, using default server")
-		return DbPool.DefaultServer, nil
+	if s, found := g.getRandomOperationalServer(); found {
+		if previous, changed := g.switchFallback(""); changed {
+			log.Logger.Info("Group has an operational server again", zap.String("group", g.Id), zap.String("previous fallback", previous))
+		}
+		return s, nil
+	}
+
+	for _, fallbackId := range g.Config.Fallback {
+		fallback, found := Groups[fallbackId]
+		if !found {
+			continue
+		}
+		if s, found := fallback.getRandomOperationalServer(); found {
+			if _, changed := g.switchFallback(fallback.Id); changed {
+				log.Logger.Warn("There is no operational server in group, using fallback group", zap.String("group", g.Id), zap.String("fallback", fallback.Id))
+			}
+			stats.Inc("group_fallback", "group", g.Id, "fallback", fallback.Id)
+			return s, nil
+		}
 	}
 
+	if g.Config.FailClosed {
+		if _, changed := g.switchFallback("fail_closed"); changed {
+			log.Logger.Warn("There is no operational server in group nor its fallbacks, failing closed", zap.String("group", g.Id))
+		}
+		stats.Inc("group_fallback", "group", g.Id, "fallback", "fail_closed")
+		return nil, fmt.Errorf("%w in group %s", ErrNoServerAvailable, g.Id)
+	}
+
+	if _, changed := g.switchFallback("default"); changed {
+		log.Logger.Warn("There is no operational server in group nor its fallbacks, using default server", zap.String("group", g.Id))
+	}
+	stats.Inc("group_fallback", "group", g.Id, "fallback", "default")
+	return DbPool.DefaultServer, nil
+}
+
+// switchFallback remembers the fallback serving the group and returns the previous one, the change is reported only
+// once instead of on every query
+func (g *Group) switchFallback(fallback string) (string, bool) {
+	if previous, _ := g.fallback.Load().(string); previous == fallback {
+		return previous, false
+	}
+	previous, _ := g.fallback.Swap(fallback).(string)
+	return previous, previous != fallback
+}
+
+// GetOperationalServer returns random operational server of the group, the fallbacks and the default server
+// aren't used
+func (g *Group) GetOperationalServer() (*Server, error) {
+	if s, found := g.getRandomOperationalServer(); found {
+		return s, nil
+	}
+	return nil, fmt.Errorf("%w in group %s", ErrNoServerAvailable, g.Id)
+}
+
+// getRandomOperationalServer returns random operational server of the group
+func (g *Group) getRandomOperationalServer() (*Server, bool) {
 	var activeServerIds []string
 	for _, serverID := range g.serverIds {
 		if server, found := g.servers[serverID]; found && server.Status == OPERATIONAL {
@@ -72,13 +134,20 @@ func (g *Group) GetRandomServer() (*Server, error) {
 	}
 
 	if len(activeServerIds) == 0 {
-		log.Logger.Debug("There is no operational server in group, using default server")
-		return DbPool.DefaultServer, nil
+		return nil, false
 	}
 
 	index := rand.Intn(len(activeServerIds))
 
-	s := g.servers[activeServerIds[index]]
+	return g.servers[activeServerIds[index]], true
+}
+
+// IsReplica checks if the group consists of replicas, such group can't execute writes
+func (g *Group) IsReplica() bool {
+	return g.Config.IsReplica()
+}
 
-	return s, nil
+// ChecksReplicationLag tells if the servers of the group should be monitored for replication lag
+func (g *Group) ChecksReplicationLag() bool {
+	return g.Config.MaxReplicationLag > 0
 }
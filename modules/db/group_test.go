@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func testGroup(id string, servers ...*Server) *Group {
+	g := &Group{Id: id, Config: config.ServerGroup{Id: id}, servers: make(map[string]*Server)}
+	for _, s := range servers {
+		g.servers[s.Config.Id] = s
+		g.serverIds = append(g.serverIds, s.Config.Id)
+	}
+	return g
+}
+
+func TestGetRandomServerLogsFallbackChanges(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log.Logger = zap.New(core)
+	defer func() { log.Logger = zap.NewNop() }()
+
+	replica := &Server{Config: config.Server{Id: "replica"}, Status: OPERATIONAL}
+	primary := &Server{Config: config.Server{Id: "primary"}, Status: OPERATIONAL}
+	rs := testGroup("rs", replica)
+	rs.Config.Fallback = []string{"ws"}
+	ws := testGroup("ws", primary)
+	Groups = map[string]*Group{"rs": rs, "ws": ws}
+	defer CreateGroups()
+
+	counters, _ := stats.Snapshot()
+	fallbacksBefore := counters["group_fallback{group=rs,fallback=ws}"]
+
+	replica.Status = LAGGING
+	for i := 0; i < 3; i++ {
+		if s, err := rs.GetRandomServer(); err != nil || s != primary {
+			t.Fatalf("GetRandomServer = %v, %v, want the server of the fallback", s, err)
+		}
+	}
+	if got := logs.FilterMessage("There is no operational server in group, using fallback group").Len(); got != 1 {
+		t.Errorf("fallback logged %d times, want once", got)
+	}
+	counters, _ = stats.Snapshot()
+	if got := counters["group_fallback{group=rs,fallback=ws}"] - fallbacksBefore; got != 3 {
+		t.Errorf("group_fallback = %d, want every query counted", got)
+	}
+
+	primary.Status = LAGGING
+	rs.Config.FailClosed = true
+	for i := 0; i < 2; i++ {
+		if _, err := rs.GetRandomServer(); !errors.Is(err, ErrNoServerAvailable) {
+			t.Fatalf("GetRandomServer = %v, want ErrNoServerAvailable", err)
+		}
+	}
+	if got := logs.FilterMessage("There is no operational server in group nor its fallbacks, failing closed").Len(); got != 1 {
+		t.Errorf("failing closed logged %d times, want once", got)
+	}
+
+	replica.Status = OPERATIONAL
+	for i := 0; i < 2; i++ {
+		if s, err := rs.GetRandomServer(); err != nil || s != replica {
+			t.Fatalf("GetRandomServer = %v, %v, want the server of the group", s, err)
+		}
+	}
+	if got := logs.FilterMessage("Group has an operational server again").Len(); got != 1 {
+		t.Errorf("recovery logged %d times, want once", got)
+	}
+
+	replica.Status = LAGGING
+	primary.Status = OPERATIONAL
+	rs.Config.FailClosed = false
+	if _, err := rs.GetRandomServer(); err != nil {
+		t.Fatal(err)
+	}
+	if got := logs.FilterMessage("There is no operational server in group, using fallback group").Len(); got != 2 {
+		t.Errorf("fallback after the recovery logged %d times, want twice in total", got)
+	}
+}
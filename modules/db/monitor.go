@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"go-proxy/modules/config"
 	"go-proxy/modules/log"
 	"go.uber.org/zap"
 	"time"
@@ -25,7 +26,8 @@ func MonitorServers(ctx context.Context) {
 							server.Status = SHUNNED
 							log.Logger.Warn("No connection with the server, server is shunned", zap.NamedError("reason", err))
 						} else {
-							server.Status = OPERATIONAL
+							server.Status = checkReplication(ctx, server)
+							checkGtid(ctx, server)
 						}
 					}
 				}
@@ -33,3 +35,50 @@ func MonitorServers(ctx context.Context) {
 		}
 	}()
 }
+
+// checkReplication returns the status of the reachable server based on its replication lag
+func checkReplication(ctx context.Context, server *Server) Status {
+	group, found := Groups[server.Config.ServerGroup]
+	if !found || !group.ChecksReplicationLag() {
+		return OPERATIONAL
+	}
+
+	lag, err := server.CheckReplicationLag(ctx, group.Config)
+	if err != nil {
+		if server.Status != LAGGING {
+			log.Logger.Warn("Couldn't read replication lag, server is lagging", zap.String("server", server.Config.Id), zap.NamedError("reason", err))
+		}
+		return LAGGING
+	}
+	server.setReplicationLag(lag)
+
+	if lag > group.Config.MaxReplicationLag {
+		if server.Status != LAGGING {
+			log.Logger.Warn(
+				"Replication lag too high, server is lagging",
+				zap.String("server", server.Config.Id),
+				zap.Duration("lag", lag),
+				zap.Duration("max", group.Config.MaxReplicationLag),
+			)
+		}
+		return LAGGING
+	}
+
+	if server.Status == LAGGING {
+		log.Logger.Info("Server caught up with replication", zap.String("server", server.Config.Id), zap.Duration("lag", lag))
+	}
+
+	return OPERATIONAL
+}
+
+// checkGtid caches the gtid set executed by the server, it's used to route causal reads without asking the server
+func checkGtid(ctx context.Context, server *Server) {
+	if config.Config.Proxy.Consistency.CausalReads != config.CausalReadsCached {
+		return
+	}
+
+	if err := server.CheckExecutedGtidSet(ctx); err != nil {
+		server.gtidExecuted.Store(nil)
+		log.Logger.Warn("Couldn't read executed gtid set", zap.String("server", server.Config.Id), zap.NamedError("reason", err))
+	}
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/config"
+	"strings"
+	"time"
+)
+
+var ErrReplicationStopped = errors.New("replication is not running")
+
+// CheckReplicationLag reads the current replication lag of the server using the lag source of its group
+func (s *Server) CheckReplicationLag(ctx context.Context, group config.ServerGroup) (time.Duration, error) {
+	conn, err := s.Pool.GetConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var lag time.Duration
+	switch group.GetLagSource() {
+	case config.LagSourceHeartbeat:
+		lag, err = heartbeatLag(conn, group.HeartbeatTable)
+	default:
+		lag, err = replicaStatusLag(conn)
+	}
+
+	// if the lag couldn't be read then drop this connection, it may be broken
+	if err != nil && !errors.Is(err, ErrReplicationStopped) {
+		s.Pool.DropConn(conn)
+		return 0, err
+	}
+
+	s.Pool.PutConn(conn)
+	return lag, err
+}
+
+// replicaStatusLag reads Seconds_Behind_Source, falls back to the pre 8.0.22 syntax if needed
+func replicaStatusLag(conn *client.Conn) (time.Duration, error) {
+	result, err := conn.Execute("SHOW REPLICA STATUS")
+	column := "Seconds_Behind_Source"
+	if err != nil {
+		result, err = conn.Execute("SHOW SLAVE STATUS")
+		column = "Seconds_Behind_Master"
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// the server is not a replica, so it can't lag
+	if result.RowNumber() == 0 {
+		return 0, nil
+	}
+
+	isNull, err := result.IsNullByName(0, column)
+	if err != nil {
+		return 0, err
+	}
+	if isNull {
+		return 0, ErrReplicationStopped
+	}
+
+	seconds, err := result.GetIntByName(0, column)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// heartbeatLag reads the lag from the newest timestamp written to the heartbeat table
+func heartbeatLag(conn *client.Conn, table string) (time.Duration, error) {
+	result, err := conn.Execute(fmt.Sprintf("SELECT UNIX_TIMESTAMP(NOW(6)) - UNIX_TIMESTAMP(MAX(ts)) AS lag FROM %s", table))
+	if err != nil {
+		return 0, err
+	}
+
+	if result.RowNumber() == 0 {
+		return 0, ErrReplicationStopped
+	}
+
+	isNull, err := result.IsNull(0, 0)
+	if err != nil {
+		return 0, err
+	}
+	if isNull {
+		return 0, ErrReplicationStopped
+	}
+
+	seconds, err := result.GetFloat(0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// lagPrecision is added to the measured lag, SHOW REPLICA STATUS reports it in whole seconds
+const lagPrecision = time.Second
+
+// HasReplicated checks if the changes made on the source at given time are known to be applied by the server
+func (s *Server) HasReplicated(t time.Time) bool {
+	sample := s.replicationLag.Load()
+	if s.Status != OPERATIONAL || sample == nil {
+		return false
+	}
+
+	return t.Before(sample.checkedAt.Add(-sample.lag - lagPrecision))
+}
+
+// setReplicationLag publishes the replication lag read by the monitor
+func (s *Server) setReplicationLag(lag time.Duration) {
+	s.replicationLag.Store(&lagSample{lag: lag, checkedAt: time.Now()})
+}
+
+// ExecutedGtidSet reads the set of transactions executed by the server the connection is connected to
+func ExecutedGtidSet(conn *client.Conn) (string, error) {
+	result, err := conn.Execute("SELECT @@GLOBAL.gtid_executed")
+	if err != nil {
+		return "", err
+	}
+
+	gtidSet, err := result.GetString(0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	// the set is returned with new lines between the source UUIDs
+	return strings.Join(strings.Fields(gtidSet), ""), nil
+}
+
+// WaitForExecutedGtidSet waits until the server the connection is connected to executes the gtid set,
+// returns false if the set wasn't executed before the timeout
+func WaitForExecutedGtidSet(conn *client.Conn, gtidSet string, timeout time.Duration) (bool, error) {
+	result, err := conn.Execute(fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET('%s', %.3f)", gtidSet, timeout.Seconds()))
+	if err != nil {
+		return false, err
+	}
+
+	timedOut, err := result.GetInt(0, 0)
+	if err != nil {
+		return false, err
+	}
+
+	return timedOut == 0, nil
+}
+
+// CheckExecutedGtidSet reads and caches the gtid set executed by the server
+func (s *Server) CheckExecutedGtidSet(ctx context.Context) error {
+	conn, err := s.Pool.GetConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	gtidSet, err := ExecutedGtidSet(conn)
+	if err != nil {
+		s.Pool.DropConn(conn)
+		return err
+	}
+	s.Pool.PutConn(conn)
+
+	parsed, err := mysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return err
+	}
+	s.gtidExecuted.Store(&gtidSample{set: parsed})
+
+	return nil
+}
+
+// HasExecuted checks if the gtid set is known to be executed by the server, uses the set cached by the monitor
+func (s *Server) HasExecuted(gtidSet string) bool {
+	executed := s.gtidExecuted.Load()
+	if s.Status != OPERATIONAL || executed == nil {
+		return false
+	}
+
+	parsed, err := mysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return false
+	}
+
+	return executed.set.Contain(parsed)
+}
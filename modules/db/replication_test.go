@@ -0,0 +1,76 @@
+package db
+
+import (
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHasReplicated(t *testing.T) {
+	s := &Server{Status: OPERATIONAL}
+	if s.HasReplicated(time.Now().Add(-time.Hour)) {
+		t.Error("HasReplicated without a lag check = true, want false")
+	}
+
+	s.setReplicationLag(2 * time.Second)
+	if !s.HasReplicated(time.Now().Add(-4 * time.Second)) {
+		t.Error("HasReplicated of a write older than the lag = false, want true")
+	}
+	if s.HasReplicated(time.Now().Add(-2 * time.Second)) {
+		t.Error("HasReplicated of a write within the lag = true, want false")
+	}
+}
+
+// TestReplicationLagConcurrency is meant to be run with -race, the monitor writes the lag while the routing reads it
+func TestReplicationLagConcurrency(t *testing.T) {
+	s := &Server{Status: OPERATIONAL}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			s.setReplicationLag(time.Duration(i) * time.Millisecond)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			s.HasReplicated(time.Now())
+		}
+	}()
+	wg.Wait()
+}
+
+func TestHasExecuted(t *testing.T) {
+	s := &Server{Status: OPERATIONAL}
+	if s.HasExecuted("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5") {
+		t.Error("HasExecuted without a gtid check = true, want false")
+	}
+
+	parsed, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.gtidExecuted.Store(&gtidSample{set: parsed})
+
+	tests := []struct {
+		gtidSet string
+		want    bool
+	}{
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", true},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11", false},
+		{"4e11fa47-71ca-11e1-9e33-c80aa9429562:1", false},
+		{"invalid", false},
+	}
+	for _, test := range tests {
+		if got := s.HasExecuted(test.gtidSet); got != test.want {
+			t.Errorf("HasExecuted(%q) = %v, want %v", test.gtidSet, got, test.want)
+		}
+	}
+
+	s.gtidExecuted.Store(nil)
+	if s.HasExecuted("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5") {
+		t.Error("HasExecuted after a failed gtid check = true, want false")
+	}
+}
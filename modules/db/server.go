@@ -4,16 +4,33 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"go-proxy/modules/config"
 	"go-proxy/modules/log"
+	"net"
+	"sync/atomic"
 	"time"
 )
 
 type Server struct {
-	Config      config.Server
-	Credentials config.DbUser
-	Status      Status
-	Pool        *client.Pool
+	Config         config.Server
+	Credentials    config.DbUser
+	Status         Status
+	Pool           *client.Pool
+	replicationLag atomic.Pointer[lagSample]  // last replication lag read by the monitor, only for groups with lag checks
+	gtidExecuted   atomic.Pointer[gtidSample] // last gtid_executed read by the monitor, only for cached causal reads
+}
+
+// gtidSample holds the gtid set read by the monitor, the interface can't be replaced atomically on its own
+type gtidSample struct {
+	set mysql.GTIDSet
+}
+
+// lagSample is the replication lag read by the monitor, it's replaced as a whole so the routing can read it
+// while the monitor writes a new one
+type lagSample struct {
+	lag       time.Duration
+	checkedAt time.Time // when the lag was read
 }
 
 func LoadServers(ctx context.Context) error {
@@ -100,3 +117,31 @@ func (s *Server) Connect(ctx context.Context) (*client.Conn, error) {
 
 	return conn, nil
 }
+
+// KillQuery kills the query running on the connection of the server, a new connection is used because the one
+// running the query is busy. The deadline of the context bounds the whole kill, including the handshake.
+func (s *Server) KillQuery(ctx context.Context, connectionId uint32) error {
+	dialer := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := conn.SetDeadline(deadline); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.Config.Host, s.Config.Port)
+	conn, err := client.ConnectWithDialer(ctx, "", addr, s.Credentials.User, s.Credentials.Password, "", dialer)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(fmt.Sprintf("KILL QUERY %d", connectionId))
+	return err
+}
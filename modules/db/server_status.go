@@ -6,11 +6,12 @@ const (
 	OPERATIONAL Status = iota // server is working in current moment
 	SHUNNED                   // there is a problem with this server, should be ignored
 	OFF                       // server is turned off and should be ignored too
+	LAGGING                   // replica is too far behind its source, should be ignored until it catches up
 )
 
 func (s Status) String() string {
-	strStatuses := [...]string{"OPERATIONAL", "SHUNNED", "OFF"}
-	if s < OPERATIONAL || s > OFF {
+	strStatuses := [...]string{"OPERATIONAL", "SHUNNED", "OFF", "LAGGING"}
+	if s < OPERATIONAL || s > LAGGING {
 		return "Unknown"
 	}
 	return strStatuses[s]
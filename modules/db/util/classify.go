@@ -0,0 +1,137 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"strings"
+)
+
+var (
+	// writeCommands are the statements that modify the data or the schema
+	writeCommands = map[string]bool{
+		"INSERT":   true,
+		"UPDATE":   true,
+		"DELETE":   true,
+		"REPLACE":  true,
+		"CREATE":   true,
+		"ALTER":    true,
+		"DROP":     true,
+		"TRUNCATE": true,
+		"RENAME":   true,
+		"GRANT":    true,
+		"REVOKE":   true,
+		"LOAD":     true,
+		"CALL":     true,
+	}
+
+	// statementCommands are the keywords that can start the main statement after a WITH clause
+	statementCommands = map[string]bool{
+		"SELECT":  true,
+		"INSERT":  true,
+		"UPDATE":  true,
+		"DELETE":  true,
+		"REPLACE": true,
+	}
+)
+
+// Tokenize returns the tokens of the query without whitespaces and comments
+func Tokenize(query string) []sqllexer.Token {
+	lexer := sqllexer.New(query, sqllexer.WithDBMS(sqllexer.DBMSMySQL))
+
+	tokens := make([]sqllexer.Token, 0)
+	for {
+		token := lexer.Scan()
+		switch token.Type {
+		case sqllexer.EOF:
+			return tokens
+		case sqllexer.WS, sqllexer.COMMENT, sqllexer.MULTILINE_COMMENT:
+			continue
+		default:
+			tokens = append(tokens, token)
+		}
+	}
+}
+
+// IsWriteCommand checks if the statement starting with the keyword always modifies data or the schema
+func IsWriteCommand(keyword string) bool {
+	return writeCommands[strings.ToUpper(keyword)]
+}
+
+// IsWriteQuery checks if the query modifies data, takes locks on rows or writes to a file,
+// such queries have to be executed by a primary server
+func IsWriteQuery(query string) bool {
+	return IsWrite(Tokenize(query))
+}
+
+// IsWrite checks if the tokenized query is a write, see IsWriteQuery
+func IsWrite(tokens []sqllexer.Token) bool {
+	command := mainCommand(tokens)
+	if writeCommands[command] {
+		return true
+	}
+
+	if command != "SELECT" {
+		return false
+	}
+
+	// SELECT ... INTO, SELECT ... FOR UPDATE, SELECT ... FOR SHARE, SELECT ... LOCK IN SHARE MODE
+	for i, token := range tokens {
+		if token.Type != sqllexer.IDENT {
+			continue
+		}
+		switch strings.ToUpper(token.Value) {
+		case "INTO":
+			return true
+		case "FOR":
+			if next := keywordAt(tokens, i+1); next == "UPDATE" || next == "SHARE" {
+				return true
+			}
+		case "LOCK":
+			if keywordAt(tokens, i+1) == "IN" && keywordAt(tokens, i+2) == "SHARE" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// mainCommand returns the upper-cased keyword of the statement, skips the WITH clause and opening parentheses
+func mainCommand(tokens []sqllexer.Token) string {
+	depth := 0
+	withClause := false
+	for i, token := range tokens {
+		switch {
+		case token.Type == sqllexer.PUNCTUATION && token.Value == "(":
+			depth++
+		case token.Type == sqllexer.PUNCTUATION && token.Value == ")":
+			depth--
+		case token.Type == sqllexer.IDENT:
+			keyword := strings.ToUpper(token.Value)
+			if i == 0 && keyword == "WITH" {
+				withClause = true
+				continue
+			}
+			if !withClause {
+				return keyword
+			}
+			if depth == 0 && statementCommands[keyword] {
+				return keyword
+			}
+		default:
+			if !withClause && depth == 0 {
+				return ""
+			}
+		}
+	}
+
+	return ""
+}
+
+// keywordAt returns the upper-cased identifier at given position or an empty string. A keyword directly followed
+// by a parenthesis, e.g. IN(1, 2) or VALUES(1), is lexed as a function name and is returned too.
+func keywordAt(tokens []sqllexer.Token, i int) string {
+	if i >= len(tokens) || (tokens[i].Type != sqllexer.IDENT && tokens[i].Type != sqllexer.FUNCTION) {
+		return ""
+	}
+	return strings.ToUpper(tokens[i].Value)
+}
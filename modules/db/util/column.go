@@ -0,0 +1,342 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"strings"
+)
+
+// ColumnValue is a value the column is compared with in the query
+type ColumnValue struct {
+	Value     string // Value is the literal without quotes, empty for bound parameters
+	Parameter int    // Parameter is the index of the bound parameter, -1 for literals
+}
+
+// IsParameter checks if the value is a bound parameter
+func (v ColumnValue) IsParameter() bool {
+	return v.Parameter >= 0
+}
+
+// whereEnd are the clauses that end the top-level WHERE clause
+var whereEnd = map[string]bool{
+	"GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true, "WINDOW": true, "FOR": true, "LOCK": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "INTO": true, "RETURNING": true,
+}
+
+// ExtractColumnValues returns the values the column is compared with, using = or IN in the top-level WHERE clause,
+// or the values inserted into it by INSERT ... (columns) VALUES (...). Comparisons in subqueries and assignments
+// (e.g. UPDATE ... SET column = 1) don't select the rows and are ignored. Found is false if any occurrence of
+// the column in the conditions can't be resolved to literals or bound parameters, or if the conditions use OR next
+// to the column.
+func ExtractColumnValues(tokens []sqllexer.Token, column string) (values []ColumnValue, found bool) {
+	if command := mainCommand(tokens); command == "INSERT" || command == "REPLACE" {
+		return extractInsertedValues(tokens, column)
+	}
+
+	parameters := parameterIndexes(tokens)
+	depths := parenthesisDepths(tokens)
+	subquery := subqueryTokens(tokens)
+	start, end, found := whereClause(tokens, depths)
+	if !found {
+		return nil, false
+	}
+
+	for i := start; i < end; i++ {
+		if subquery[i] || !isColumn(tokens[i], column) {
+			continue
+		}
+
+		var columnValues []ColumnValue
+		var ok bool
+		switch {
+		case i+1 < len(tokens) && tokens[i+1].Type == sqllexer.OPERATOR && tokens[i+1].Value == "=":
+			columnValues, ok = valuesAt(tokens, parameters, i+2, i+3)
+		case keywordAt(tokens, i+1) == "IN" && i+2 < len(tokens) && tokens[i+2].Value == "(":
+			columnValues, ok = valueList(tokens, parameters, i+3)
+		case i+1 < len(tokens) && isComparison(tokens[i+1]):
+			// compared in a way that can't be resolved to values
+			return nil, false
+		default:
+			// selected, grouped or ordered by the column
+			continue
+		}
+		if !ok || hasOrAround(tokens[:end], depths, i, start) {
+			return nil, false
+		}
+
+		values = append(values, columnValues...)
+	}
+
+	return values, len(values) > 0
+}
+
+// AssignsColumn checks if the statement sets a new value of the column, by UPDATE ... SET or by INSERT ... ON
+// DUPLICATE KEY UPDATE
+func AssignsColumn(tokens []sqllexer.Token, column string) bool {
+	depths := parenthesisDepths(tokens)
+	update := mainCommand(tokens) == "UPDATE"
+	assignments := false
+	for i, token := range tokens {
+		if depths[i] != 0 {
+			continue
+		}
+
+		switch keyword := keywordAt(tokens, i); {
+		case keyword == "SET" && update:
+			assignments = true
+		case keyword == "UPDATE" && i >= 2 && keywordAt(tokens, i-1) == "KEY" && keywordAt(tokens, i-2) == "DUPLICATE":
+			assignments = true
+		case keyword == "WHERE" || whereEnd[keyword]:
+			assignments = false
+		case assignments && isColumn(token, column) && i+1 < len(tokens) && tokens[i+1].Value == "=":
+			return true
+		}
+	}
+	return false
+}
+
+// whereClause returns the bounds of the top-level WHERE clause, without the WHERE keyword
+func whereClause(tokens []sqllexer.Token, depths []int) (int, int, bool) {
+	start := -1
+	for i := range tokens {
+		if depths[i] != 0 {
+			continue
+		}
+		keyword := keywordAt(tokens, i)
+		switch {
+		case start == -1 && keyword == "WHERE":
+			start = i + 1
+		case start != -1 && (whereEnd[keyword] || tokens[i].Value == ";"):
+			return start, i, true
+		}
+	}
+
+	return start, len(tokens), start != -1
+}
+
+// subqueryTokens marks the tokens inside the subqueries, i.e. the parentheses starting with SELECT or WITH
+func subqueryTokens(tokens []sqllexer.Token) []bool {
+	inside := make([]bool, len(tokens))
+	var groups []bool // every open parenthesis, true if it's a subquery
+	open := 0         // number of the open subqueries
+	for i, token := range tokens {
+		if token.Type == sqllexer.PUNCTUATION && token.Value == ")" && len(groups) > 0 {
+			if groups[len(groups)-1] {
+				open--
+			}
+			groups = groups[:len(groups)-1]
+		}
+		inside[i] = open > 0
+		if token.Type == sqllexer.PUNCTUATION && token.Value == "(" {
+			keyword := keywordAt(tokens, i+1)
+			isSubquery := keyword == "SELECT" || keyword == "WITH"
+			groups = append(groups, isSubquery)
+			if isSubquery {
+				open++
+			}
+		}
+	}
+	return inside
+}
+
+// extractInsertedValues returns the values inserted into the column by INSERT ... (columns) VALUES (...), (...)
+func extractInsertedValues(tokens []sqllexer.Token, column string) ([]ColumnValue, bool) {
+	parameters := parameterIndexes(tokens)
+
+	// find the position of the column in the column list
+	position, i := -1, 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].Value == "(" {
+			break
+		}
+	}
+	for index := 0; i < len(tokens) && tokens[i].Value != ")"; i++ {
+		if isColumn(tokens[i], column) {
+			position = index
+		}
+		if tokens[i].Value == "," {
+			index++
+		}
+	}
+	if position == -1 {
+		return nil, false
+	}
+
+	// skip to the values
+	for ; i < len(tokens); i++ {
+		if keyword := keywordAt(tokens, i); keyword == "VALUES" || keyword == "VALUE" {
+			break
+		}
+	}
+
+	var values []ColumnValue
+	for i++; i < len(tokens) && tokens[i].Value == "("; {
+		row, end, ok := valueRow(tokens, parameters, i+1)
+		if !ok || position >= len(row) {
+			return nil, false
+		}
+		values = append(values, row[position])
+
+		i = end + 1
+		if i < len(tokens) && tokens[i].Value == "," {
+			i++
+		}
+	}
+
+	return values, len(values) > 0
+}
+
+// valueRow reads the comma separated literals or parameters starting at i until the closing parenthesis,
+// returns the position of the parenthesis
+func valueRow(tokens []sqllexer.Token, parameters map[int]int, i int) ([]ColumnValue, int, bool) {
+	var row []ColumnValue
+	for ; i < len(tokens); i++ {
+		value, ok := valueAt(tokens, parameters, i)
+		if !ok {
+			return nil, 0, false
+		}
+		row = append(row, value)
+
+		i++
+		if i >= len(tokens) {
+			return nil, 0, false
+		}
+		if tokens[i].Value == ")" {
+			return row, i, true
+		}
+		if tokens[i].Value != "," {
+			return nil, 0, false
+		}
+	}
+
+	return nil, 0, false
+}
+
+// valueList reads the values of IN (...) starting at i
+func valueList(tokens []sqllexer.Token, parameters map[int]int, i int) ([]ColumnValue, bool) {
+	row, _, ok := valueRow(tokens, parameters, i)
+	return row, ok
+}
+
+// valuesAt reads single value at i, the value has to be followed by the end of the expression at next
+func valuesAt(tokens []sqllexer.Token, parameters map[int]int, i int, next int) ([]ColumnValue, bool) {
+	value, ok := valueAt(tokens, parameters, i)
+	if !ok {
+		return nil, false
+	}
+
+	// the value can't be a part of an expression, e.g. tenant_id = 1 + 2
+	if next < len(tokens) && (tokens[next].Type == sqllexer.OPERATOR || tokens[next].Value == "(") {
+		return nil, false
+	}
+
+	return []ColumnValue{value}, true
+}
+
+// valueAt reads the literal or bound parameter at i
+func valueAt(tokens []sqllexer.Token, parameters map[int]int, i int) (ColumnValue, bool) {
+	if i >= len(tokens) {
+		return ColumnValue{}, false
+	}
+
+	token := tokens[i]
+	switch {
+	case token.Type == sqllexer.NUMBER:
+		return ColumnValue{Value: token.Value, Parameter: -1}, true
+	case token.Type == sqllexer.STRING:
+		return ColumnValue{Value: unquoteString(token.Value), Parameter: -1}, true
+	case token.Type == sqllexer.OPERATOR && token.Value == "?":
+		return ColumnValue{Parameter: parameters[i]}, true
+	default:
+		return ColumnValue{}, false
+	}
+}
+
+// parameterIndexes maps the positions of bound parameters (?) in tokens to their indexes
+func parameterIndexes(tokens []sqllexer.Token) map[int]int {
+	parameters := make(map[int]int)
+	for i, token := range tokens {
+		if token.Type == sqllexer.OPERATOR && token.Value == "?" {
+			parameters[i] = len(parameters)
+		}
+	}
+	return parameters
+}
+
+// parenthesisDepths returns the parenthesis depth of every token
+func parenthesisDepths(tokens []sqllexer.Token) []int {
+	depths := make([]int, len(tokens))
+	depth := 0
+	for i, token := range tokens {
+		if token.Type == sqllexer.PUNCTUATION && token.Value == ")" {
+			depth--
+		}
+		depths[i] = depth
+		if token.Type == sqllexer.PUNCTUATION && token.Value == "(" {
+			depth++
+		}
+	}
+	return depths
+}
+
+// hasOrAround checks if there is an OR in the parenthesis group of the token at i or in any group enclosing it,
+// such OR could make the rows match without the column condition. Only the tokens from start are checked.
+func hasOrAround(tokens []sqllexer.Token, depths []int, i int, start int) bool {
+	for j := start; j < len(tokens); j++ {
+		token := tokens[j]
+		isOr := keywordAt(tokens, j) == "OR" ||
+			(token.Type == sqllexer.OPERATOR && token.Value == "||")
+		if !isOr || depths[j] > depths[i] {
+			continue
+		}
+
+		// the OR and the token are in the same group if the depth doesn't go below the OR between them
+		from, to := min(i, j), max(i, j)
+		sameGroup := true
+		for k := from; k <= to; k++ {
+			if depths[k] < depths[j] {
+				sameGroup = false
+				break
+			}
+		}
+		if sameGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// isComparison checks if the token compares the column with something else than a single value
+func isComparison(token sqllexer.Token) bool {
+	if token.Type == sqllexer.OPERATOR {
+		return true
+	}
+
+	switch strings.ToUpper(token.Value) {
+	case "LIKE", "BETWEEN", "NOT", "IS", "REGEXP", "RLIKE":
+		return true
+	default:
+		return false
+	}
+}
+
+// isColumn checks if the token is the column, the table qualifier and quotes are ignored
+func isColumn(token sqllexer.Token, column string) bool {
+	if token.Type != sqllexer.IDENT && token.Type != sqllexer.QUOTED_IDENT {
+		return false
+	}
+
+	name := token.Value
+	if index := strings.LastIndex(name, "."); index != -1 {
+		name = name[index+1:]
+	}
+
+	return strings.EqualFold(strings.Trim(name, "`\""), column)
+}
+
+// unquoteString removes the quotes of the string literal
+func unquoteString(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') {
+		value = value[1 : len(value)-1]
+	}
+	return value
+}
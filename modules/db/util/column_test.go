@@ -0,0 +1,72 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractColumnValues(t *testing.T) {
+	tests := []struct {
+		query  string
+		values []ColumnValue
+		found  bool
+	}{
+		{"SELECT * FROM t WHERE tenant_id = 1", []ColumnValue{{Value: "1", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE t.tenant_id = 'a'", []ColumnValue{{Value: "a", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE a = ? AND tenant_id = ?", []ColumnValue{{Parameter: 1}}, true},
+		{"SELECT * FROM t WHERE tenant_id IN (1, 2)", []ColumnValue{{Value: "1", Parameter: -1}, {Value: "2", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE tenant_id IN(1,2)", []ColumnValue{{Value: "1", Parameter: -1}, {Value: "2", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE tenant_id in(?)", []ColumnValue{{Parameter: 0}}, true},
+		{"SELECT * FROM t WHERE tenant_id = 1 OR a = 2", nil, false},
+		{"SELECT * FROM t WHERE tenant_id = 1 OR(a = 2)", nil, false},
+		{"SELECT * FROM t WHERE (tenant_id = 1 AND a = 1) OR a = 2", nil, false},
+		{"SELECT * FROM t WHERE tenant_id = 1 AND (a = 1 OR a = 2)", []ColumnValue{{Value: "1", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE tenant_id > 1", nil, false},
+		{"SELECT * FROM t WHERE tenant_id = 1 + 2", nil, false},
+		{"SELECT * FROM t WHERE a = 1", nil, false},
+		{"INSERT INTO t (tenant_id, a) VALUES (1, 2), (3, 4)", []ColumnValue{{Value: "1", Parameter: -1}, {Value: "3", Parameter: -1}}, true},
+		{"INSERT INTO t(tenant_id,a) VALUES(1,2)", []ColumnValue{{Value: "1", Parameter: -1}}, true},
+		{"INSERT INTO t(a,tenant_id) VALUES(?,?),(?,?)", []ColumnValue{{Parameter: 1}, {Parameter: 3}}, true},
+		{"REPLACE INTO t (tenant_id) VALUE (5)", []ColumnValue{{Value: "5", Parameter: -1}}, true},
+		{"INSERT INTO t (tenant_id) VALUES (NOW())", nil, false},
+		{"UPDATE t SET tenant_id = 5 WHERE id = 1", nil, false},
+		{"UPDATE t SET a = 5 WHERE tenant_id = 1", []ColumnValue{{Value: "1", Parameter: -1}}, true},
+		{"DELETE FROM t WHERE tenant_id = 2 LIMIT 1", []ColumnValue{{Value: "2", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE id IN (SELECT id FROM u WHERE tenant_id = 1)", nil, false},
+		{"SELECT * FROM t WHERE tenant_id = 3 AND id IN (SELECT id FROM u WHERE tenant_id = 1 OR a = 1)", []ColumnValue{{Value: "3", Parameter: -1}}, true},
+		{"SELECT * FROM t WHERE EXISTS(SELECT 1 FROM u WHERE u.tenant_id = 1)", nil, false},
+		{"SELECT (SELECT a FROM u WHERE tenant_id = 1) FROM t", nil, false},
+		{"SELECT * FROM t JOIN u ON u.tenant_id = 1 WHERE t.a = 1", nil, false},
+		{"SELECT * FROM t WHERE a = 1 ORDER BY tenant_id = 1", nil, false},
+		{"SELECT a OR b FROM t WHERE tenant_id = 4", []ColumnValue{{Value: "4", Parameter: -1}}, true},
+		{"INSERT INTO t (a) VALUES (1)", nil, false},
+	}
+
+	for _, test := range tests {
+		values, found := ExtractColumnValues(Tokenize(test.query), "tenant_id")
+		if found != test.found || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("ExtractColumnValues(%q) = %v, %v, want %v, %v", test.query, values, found, test.values, test.found)
+		}
+	}
+}
+
+func TestAssignsColumn(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"UPDATE t SET tenant_id = 5 WHERE id = 1", true},
+		{"UPDATE t SET a = 1, t.`tenant_id` = ? WHERE tenant_id = 1", true},
+		{"UPDATE t SET a = 1 WHERE tenant_id = 1", false},
+		{"UPDATE t SET a = (SELECT tenant_id = 1 FROM u) WHERE id = 1", false},
+		{"INSERT INTO t (tenant_id, a) VALUES (1, 2) ON DUPLICATE KEY UPDATE tenant_id = 3", true},
+		{"INSERT INTO t (tenant_id, a) VALUES (1, 2) ON DUPLICATE KEY UPDATE a = 3", false},
+		{"SELECT * FROM t WHERE tenant_id = 1", false},
+	}
+
+	for _, test := range tests {
+		if got := AssignsColumn(Tokenize(test.query), "tenant_id"); got != test.want {
+			t.Errorf("AssignsColumn(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"strings"
+)
+
+var (
+	// nonDeterministicFunctions return a different value for the same data, e.g. depending on the time,
+	// on the session or at random
+	nonDeterministicFunctions = map[string]bool{
+		"NOW": true, "SYSDATE": true, "CURDATE": true, "CURTIME": true, "CURRENT_DATE": true, "CURRENT_TIME": true,
+		"CURRENT_TIMESTAMP": true, "LOCALTIME": true, "LOCALTIMESTAMP": true, "UTC_DATE": true, "UTC_TIME": true,
+		"UTC_TIMESTAMP": true, "UNIX_TIMESTAMP": true, "RAND": true, "RANDOM_BYTES": true, "UUID": true,
+		"UUID_SHORT": true, "CONNECTION_ID": true, "LAST_INSERT_ID": true, "ROW_COUNT": true, "FOUND_ROWS": true,
+		"USER": true, "CURRENT_USER": true, "SESSION_USER": true, "SYSTEM_USER": true, "CURRENT_ROLE": true,
+		"SLEEP": true, "BENCHMARK": true, "GET_LOCK": true, "IS_FREE_LOCK": true, "IS_USED_LOCK": true,
+		"NEXTVAL": true, "LASTVAL": true,
+	}
+
+	// nonDeterministicKeywords are the functions that can be called without parentheses
+	nonDeterministicKeywords = map[string]bool{
+		"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "LOCALTIME": true,
+		"LOCALTIMESTAMP": true, "UTC_DATE": true, "UTC_TIME": true, "UTC_TIMESTAMP": true, "CURRENT_USER": true,
+	}
+)
+
+// IsDeterministic checks if the result of the tokenized query depends only on the data, queries calling
+// non-deterministic functions like NOW(), RAND() or UUID() or reading user or system variables aren't deterministic
+func IsDeterministic(tokens []sqllexer.Token) bool {
+	for i, token := range tokens {
+		if IsFunctionCall(tokens, i) && nonDeterministicFunctions[strings.ToUpper(token.Value)] {
+			return false
+		}
+
+		switch token.Type {
+		case sqllexer.IDENT:
+			if nonDeterministicKeywords[strings.ToUpper(token.Value)] {
+				return false
+			}
+		case sqllexer.BIND_PARAMETER, sqllexer.SYSTEM_VARIABLE:
+			if strings.HasPrefix(token.Value, "@") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,27 @@
+package util
+
+import "testing"
+
+func TestIsDeterministic(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM t WHERE a = 1", true},
+		{"SELECT COUNT(*) FROM t", true},
+		{"SELECT NOW()", false},
+		{"SELECT RAND ()", false},
+		{"SELECT uuid ()", false},
+		{"SELECT * FROM t WHERE created < CURRENT_TIMESTAMP", false},
+		{"SELECT * FROM t WHERE a = @a", false},
+		{"SELECT @@version", false},
+		{"SELECT * FROM t WHERE a = ?", true},
+		{"SELECT rand FROM t", true},
+	}
+
+	for _, test := range tests {
+		if got := IsDeterministic(Tokenize(test.query)); got != test.want {
+			t.Errorf("IsDeterministic(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
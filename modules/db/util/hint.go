@@ -0,0 +1,61 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"regexp"
+	"strings"
+)
+
+var (
+	// commentHint matches /* go-proxy: group=RS */
+	commentHint = regexp.MustCompile(`(?is)^/\*\s*go-proxy\s*:\s*group\s*=\s*([\w-]+)\s*\*/$`)
+	// optimizerHint matches go_proxy_target(WS) inside of /*+ ... */
+	optimizerHint = regexp.MustCompile(`(?i)go_proxy_target\(\s*([\w-]+)\s*\)`)
+)
+
+// RoutingHint is the group requested by a comment of the query
+type RoutingHint struct {
+	Group    string // Group requested by the hint
+	Stripped string // Stripped is the query without the hint
+}
+
+// FindRoutingHint finds the first routing hint in the comments of the query, /* go-proxy: group=RS */ or
+// /*+ go_proxy_target(WS) */, comments inside of the string literals are ignored
+func FindRoutingHint(query string) (RoutingHint, bool) {
+	lexer := sqllexer.New(query, sqllexer.WithDBMS(sqllexer.DBMSMySQL))
+
+	offset := 0
+	for {
+		token := lexer.Scan()
+		if token.Type == sqllexer.EOF {
+			return RoutingHint{}, false
+		}
+
+		start := offset
+		offset += len(token.Value)
+		if token.Type != sqllexer.MULTILINE_COMMENT {
+			continue
+		}
+		if offset > len(query) || query[start:offset] != token.Value {
+			// the token doesn't map to the query, the position of the hint is unknown
+			return RoutingHint{}, false
+		}
+
+		if match := commentHint.FindStringSubmatch(token.Value); match != nil {
+			return RoutingHint{Group: match[1], Stripped: query[:start] + query[offset:]}, true
+		}
+
+		if !strings.HasPrefix(token.Value, "/*+") {
+			continue
+		}
+		if match := optimizerHint.FindStringSubmatchIndex(token.Value); match != nil {
+			group := token.Value[match[2]:match[3]]
+			remaining := token.Value[:match[0]] + token.Value[match[1]:]
+			if strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(remaining, "/*+"), "*/")) == "" {
+				// the comment contained only the routing hint
+				remaining = ""
+			}
+			return RoutingHint{Group: group, Stripped: query[:start] + remaining + query[offset:]}, true
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import "testing"
+
+func TestFindRoutingHint(t *testing.T) {
+	tests := []struct {
+		query    string
+		found    bool
+		group    string
+		stripped string
+	}{
+		{"/* go-proxy: group=RS */ SELECT 1", true, "RS", " SELECT 1"},
+		{"SELECT /*go-proxy:group=ws-2*/ 1", true, "ws-2", "SELECT  1"},
+		{"SELECT 1 /* GO-PROXY : GROUP = rs_1 */", true, "rs_1", "SELECT 1 "},
+		{"/*\n  go-proxy: group=RS\n*/ SELECT 1", true, "RS", " SELECT 1"},
+		{"SELECT /*+ go_proxy_target(WS) */ a FROM t", true, "WS", "SELECT  a FROM t"},
+		{"SELECT /*+ MAX_EXECUTION_TIME(100) GO_PROXY_TARGET( RS ) */ a FROM t", true, "RS", "SELECT /*+ MAX_EXECUTION_TIME(100)  */ a FROM t"},
+		// unknown groups are returned, the proxy ignores the hints of the groups it doesn't have
+		{"/* go-proxy: group=missing */ SELECT 1", true, "missing", " SELECT 1"},
+		// multiple hints, the first one wins and only it is stripped
+		{"/* go-proxy: group=A */ SELECT /* go-proxy: group=B */ 1", true, "A", " SELECT /* go-proxy: group=B */ 1"},
+		{"SELECT /*+ go_proxy_target(A) */ 1 /* go-proxy: group=B */", true, "A", "SELECT  1 /* go-proxy: group=B */"},
+		{"SELECT /* note */ 1 /* go-proxy: group=B */", true, "B", "SELECT /* note */ 1 "},
+		// hints inside of the string literals and identifiers aren't comments
+		{"SELECT '/* go-proxy: group=RS */'", false, "", ""},
+		{`SELECT "/*+ go_proxy_target(WS) */"`, false, "", ""},
+		{"SELECT `/* go-proxy: group=RS */` FROM t", false, "", ""},
+		{"SELECT '/* go-proxy: group=A */', 1 /* go-proxy: group=B */", true, "B", "SELECT '/* go-proxy: group=A */', 1 "},
+		// malformed hints
+		{"-- go-proxy: group=RS\nSELECT 1", false, "", ""},
+		{"# go-proxy: group=RS\nSELECT 1", false, "", ""},
+		{"/* go-proxy: group= */ SELECT 1", false, "", ""},
+		{"/* go-proxy: group=RS WS */ SELECT 1", false, "", ""},
+		{"/* go-proxy: group=RS; DROP */ SELECT 1", false, "", ""},
+		{"/* note go-proxy: group=RS */ SELECT 1", false, "", ""},
+		{"/* go-proxy group=RS */ SELECT 1", false, "", ""},
+		{"/* go-proxy: group=RS SELECT 1", false, "", ""},
+		{"/* go_proxy_target(WS) */ SELECT 1", false, "", ""},
+		{"SELECT /*+ go_proxy_target() */ 1", false, "", ""},
+		{"SELECT /*+ go_proxy_target(W S) */ 1", false, "", ""},
+		{"SELECT 1", false, "", ""},
+		{"", false, "", ""},
+	}
+
+	for _, test := range tests {
+		hint, found := FindRoutingHint(test.query)
+		if found != test.found || hint.Group != test.group || hint.Stripped != test.stripped {
+			t.Errorf("FindRoutingHint(%q) = %q, %q, %v, want %q, %q, %v",
+				test.query, hint.Group, hint.Stripped, found, test.group, test.stripped, test.found)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"strings"
+)
+
+// SessionStatement describes how the statement changes the state kept by the server connection of the session
+type SessionStatement struct {
+	LockTables             bool     // LockTables is set by LOCK TABLES
+	UnlockTables           bool     // UnlockTables is set by UNLOCK TABLES
+	NamedLocks             int      // NamedLocks is the number of GET_LOCK() calls
+	ReleasedLocks          int      // ReleasedLocks is the number of RELEASE_LOCK() calls
+	ReleaseAllLocks        bool     // ReleaseAllLocks is set by RELEASE_ALL_LOCKS()
+	CreatedTemporaryTables []string // CreatedTemporaryTables are created by CREATE TEMPORARY TABLE
+	DroppedTables          []string // DroppedTables are dropped by DROP [TEMPORARY] TABLE
+	SetVariables           []string // SetVariables are the user variables set to a value
+	ClearedVariables       []string // ClearedVariables are the user variables set to NULL
+	Prepared               []string // Prepared are the statements prepared by PREPARE ... FROM
+	Deallocated            []string // Deallocated are the statements deallocated by DEALLOCATE PREPARE or DROP PREPARE
+	FoundRows              bool     // FoundRows is set by SQL_CALC_FOUND_ROWS, FOUND_ROWS() has to be read on the same connection
+}
+
+// CreatesState checks if the statement leaves a state on the connection that the next statements depend on
+func (s SessionStatement) CreatesState() bool {
+	return s.LockTables || s.NamedLocks > 0 || len(s.CreatedTemporaryTables) > 0 || len(s.SetVariables) > 0 ||
+		len(s.Prepared) > 0
+}
+
+// AnalyzeSessionStatement finds the changes of the connection state made by the tokenized statement
+func AnalyzeSessionStatement(tokens []sqllexer.Token) SessionStatement {
+	var statement SessionStatement
+
+	switch mainCommand(tokens) {
+	case "LOCK":
+		if next := keywordAt(tokens, 1); next == "TABLE" || next == "TABLES" {
+			statement.LockTables = true
+		}
+	case "UNLOCK":
+		if next := keywordAt(tokens, 1); next == "TABLE" || next == "TABLES" {
+			statement.UnlockTables = true
+		}
+	case "CREATE":
+		if keywordAt(tokens, 1) == "TEMPORARY" && keywordAt(tokens, 2) == "TABLE" {
+			statement.CreatedTemporaryTables = tableNames(tokens, 3, false)
+		}
+	case "DROP":
+		switch {
+		case keywordAt(tokens, 1) == "TABLE":
+			statement.DroppedTables = tableNames(tokens, 2, true)
+		case keywordAt(tokens, 1) == "TEMPORARY" && keywordAt(tokens, 2) == "TABLE":
+			statement.DroppedTables = tableNames(tokens, 3, true)
+		case keywordAt(tokens, 1) == "PREPARE" && len(tokens) > 2:
+			statement.Deallocated = []string{identifierName(tokens[2].Value)}
+		}
+	case "DEALLOCATE":
+		if keywordAt(tokens, 1) == "PREPARE" && len(tokens) > 2 {
+			statement.Deallocated = []string{identifierName(tokens[2].Value)}
+		}
+	case "PREPARE":
+		if len(tokens) > 1 {
+			statement.Prepared = []string{identifierName(tokens[1].Value)}
+		}
+	}
+
+	into := false
+	for i, token := range tokens {
+		if IsFunctionCall(tokens, i) {
+			switch strings.ToUpper(token.Value) {
+			case "GET_LOCK":
+				statement.NamedLocks++
+			case "RELEASE_LOCK":
+				statement.ReleasedLocks++
+			case "RELEASE_ALL_LOCKS":
+				statement.ReleaseAllLocks = true
+			}
+		}
+
+		switch token.Type {
+		case sqllexer.IDENT:
+			switch strings.ToUpper(token.Value) {
+			case "SQL_CALC_FOUND_ROWS":
+				statement.FoundRows = true
+			case "INTO":
+				into = true
+			case "FROM":
+				into = false
+			}
+		case sqllexer.BIND_PARAMETER:
+			if !strings.HasPrefix(token.Value, "@") || strings.HasPrefix(token.Value, "@@") {
+				continue
+			}
+			name := strings.ToLower(identifierName(strings.TrimPrefix(token.Value, "@")))
+			isAssignment := i+1 < len(tokens) && tokens[i+1].Type == sqllexer.OPERATOR &&
+				(tokens[i+1].Value == ":=" || (tokens[i+1].Value == "=" && mainCommand(tokens) == "SET"))
+			switch {
+			case isAssignment && isNullValue(tokens, i+2):
+				statement.ClearedVariables = append(statement.ClearedVariables, name)
+			case isAssignment || into:
+				statement.SetVariables = append(statement.SetVariables, name)
+			}
+		}
+	}
+
+	return statement
+}
+
+// tableNames reads the comma separated table names starting at i, skips IF [NOT] EXISTS
+func tableNames(tokens []sqllexer.Token, i int, list bool) []string {
+	if keywordAt(tokens, i) == "IF" {
+		i++
+		if keywordAt(tokens, i) == "NOT" {
+			i++
+		}
+		i++
+	}
+
+	names := make([]string, 0, 1)
+	for ; i < len(tokens); i++ {
+		// CREATE TEMPORARY TABLE t(...) lexes the name as a function
+		if tokens[i].Type != sqllexer.IDENT && tokens[i].Type != sqllexer.QUOTED_IDENT && tokens[i].Type != sqllexer.FUNCTION {
+			break
+		}
+		names = append(names, identifierName(tokens[i].Value))
+
+		if !list || i+1 >= len(tokens) || tokens[i+1].Value != "," {
+			break
+		}
+		i++
+	}
+
+	return names
+}
+
+// IsFunctionCall checks if the token at i is a function name, the lexer recognizes only the names directly followed
+// by the parenthesis, but MySQL allows a space before it, e.g. GET_LOCK ('a', 1)
+func IsFunctionCall(tokens []sqllexer.Token, i int) bool {
+	switch tokens[i].Type {
+	case sqllexer.FUNCTION:
+		return true
+	case sqllexer.IDENT:
+		return i+1 < len(tokens) && tokens[i+1].Type == sqllexer.PUNCTUATION && tokens[i+1].Value == "("
+	default:
+		return false
+	}
+}
+
+// isNullValue checks if the assigned value at i is just NULL
+func isNullValue(tokens []sqllexer.Token, i int) bool {
+	return keywordAt(tokens, i) == "NULL" && (i+1 >= len(tokens) || tokens[i+1].Value == "," || tokens[i+1].Value == ";")
+}
+
+// identifierName removes the schema qualifier and the quotes of the identifier
+func identifierName(name string) string {
+	if index := strings.LastIndex(name, "."); index != -1 {
+		name = name[index+1:]
+	}
+	return strings.Trim(name, "`\"'")
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeSessionStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  SessionStatement
+	}{
+		{"LOCK TABLES t WRITE", SessionStatement{LockTables: true}},
+		{"UNLOCK TABLES", SessionStatement{UnlockTables: true}},
+		{"CREATE TEMPORARY TABLE tmp (id INT)", SessionStatement{CreatedTemporaryTables: []string{"tmp"}}},
+		{"CREATE TEMPORARY TABLE tmp(id INT)", SessionStatement{CreatedTemporaryTables: []string{"tmp"}}},
+		{"CREATE TEMPORARY TABLE IF NOT EXISTS db.tmp(id INT)", SessionStatement{CreatedTemporaryTables: []string{"tmp"}}},
+		{"CREATE TABLE t (id INT)", SessionStatement{}},
+		{"DROP TEMPORARY TABLE IF EXISTS a, `b`", SessionStatement{DroppedTables: []string{"a", "b"}}},
+		{"SELECT GET_LOCK('a', 1)", SessionStatement{NamedLocks: 1}},
+		{"SELECT GET_LOCK ('a', 1)", SessionStatement{NamedLocks: 1}},
+		{"SELECT RELEASE_LOCK ('a'), RELEASE_ALL_LOCKS()", SessionStatement{ReleasedLocks: 1, ReleaseAllLocks: true}},
+		{"SELECT get_lock FROM t", SessionStatement{}},
+		{"SET @a = 1", SessionStatement{SetVariables: []string{"a"}}},
+		{"SET @a = NULL", SessionStatement{ClearedVariables: []string{"a"}}},
+		{"SELECT a INTO @b FROM t", SessionStatement{SetVariables: []string{"b"}}},
+		{"SELECT SQL_CALC_FOUND_ROWS * FROM t", SessionStatement{FoundRows: true}},
+		{"PREPARE s FROM 'SELECT 1'", SessionStatement{Prepared: []string{"s"}}},
+		{"DEALLOCATE PREPARE s", SessionStatement{Deallocated: []string{"s"}}},
+	}
+
+	for _, test := range tests {
+		if got := AnalyzeSessionStatement(Tokenize(test.query)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("AnalyzeSessionStatement(%q) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
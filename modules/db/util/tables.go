@@ -0,0 +1,145 @@
+package util
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"slices"
+	"strings"
+)
+
+var (
+	// tableKeywords are followed by the table names
+	tableKeywords = map[string]bool{
+		"FROM":          true,
+		"JOIN":          true,
+		"STRAIGHT_JOIN": true,
+		"INTO":          true,
+		"TABLE":         true,
+		"UPDATE":        true,
+	}
+
+	// tableModifiers can stand between the table keyword and the table names
+	tableModifiers = map[string]bool{
+		"IF":            true,
+		"NOT":           true,
+		"EXISTS":        true,
+		"TABLE":         true,
+		"TEMPORARY":     true,
+		"LOW_PRIORITY":  true,
+		"HIGH_PRIORITY": true,
+		"DELAYED":       true,
+		"IGNORE":        true,
+		"QUICK":         true,
+		"ONLY":          true,
+	}
+
+	// notTableNames are the keywords that end the list of the table names
+	notTableNames = map[string]bool{
+		"SELECT": true, "WITH": true, "WHERE": true, "SET": true, "VALUES": true, "VALUE": true, "ON": true,
+		"USING": true, "AS": true, "JOIN": true, "STRAIGHT_JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true,
+		"OUTER": true, "CROSS": true, "NATURAL": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+		"UNION": true, "EXCEPT": true, "INTERSECT": true, "FOR": true, "LOCK": true, "WINDOW": true,
+		"PARTITION": true, "FORCE": true, "USE": true, "IGNORE": true, "OUTFILE": true, "DUMPFILE": true,
+		"DUAL": true, "LATERAL": true, "TO": true, "ADD": true, "DROP": true, "MODIFY": true, "CHANGE": true,
+		"RENAME": true, "LIKE": true, "CHARACTER": true, "FIELDS": true, "COLUMNS": true, "LINES": true,
+		"INTO": true, "JSON_TABLE": true,
+	}
+)
+
+// TableNames returns the names of the tables read or written by the tokenized statement, schema-qualified names
+// keep the schema (schema.table), the quotes are removed. Names of derived tables and CTEs can be returned too.
+func TableNames(tokens []sqllexer.Token) []string {
+	command := mainCommand(tokens)
+	names := make([]string, 0, 2)
+	for i, token := range tokens {
+		if token.Type != sqllexer.IDENT {
+			continue
+		}
+
+		keyword := strings.ToUpper(token.Value)
+		switch {
+		case i == 0 && (keyword == "INSERT" || keyword == "REPLACE" || keyword == "TRUNCATE"):
+			// INSERT t, REPLACE t and TRUNCATE t without INTO or TABLE
+		case keyword == "UPDATE" && i > 0 && (keywordAt(tokens, i-1) == "KEY" || keywordAt(tokens, i-1) == "FOR"):
+			// ON DUPLICATE KEY UPDATE and FOR UPDATE aren't followed by tables
+			continue
+		case keyword == "TO" && (command == "RENAME" || command == "ALTER"):
+			// RENAME TABLE a TO b, ALTER TABLE a RENAME TO b
+		case !tableKeywords[keyword]:
+			continue
+		}
+
+		for _, name := range tableList(tokens, i+1) {
+			// e.g. INTO TABLE t reads the name after both keywords
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// tableList reads the comma separated table names with optional aliases starting at i
+func tableList(tokens []sqllexer.Token, i int) []string {
+	for i < len(tokens) && tableModifiers[keywordAt(tokens, i)] {
+		i++
+	}
+
+	names := make([]string, 0, 1)
+	for {
+		name, next, found := tableName(tokens, i)
+		if !found {
+			return names
+		}
+		names = append(names, name)
+		i = next
+
+		// alias
+		if keywordAt(tokens, i) == "AS" {
+			i += 2
+		} else if i < len(tokens) && tokens[i].Type == sqllexer.IDENT && !notTableNames[keywordAt(tokens, i)] {
+			i++
+		}
+
+		if i >= len(tokens) || tokens[i].Value != "," {
+			return names
+		}
+		i++
+	}
+}
+
+// tableName reads the possibly qualified table name at i, returns the name and the position after it
+func tableName(tokens []sqllexer.Token, i int) (string, int, bool) {
+	if !isNamePart(tokens, i) || notTableNames[keywordAt(tokens, i)] {
+		return "", i, false
+	}
+
+	// `schema`.`table` can be split into several tokens
+	raw := tokens[i].Value
+	i++
+	for i+1 < len(tokens) && tokens[i].Value == "." && isNamePart(tokens, i+1) {
+		raw += "." + tokens[i+1].Value
+		i += 2
+	}
+
+	parts := strings.Split(raw, ".")
+	for j, part := range parts {
+		parts[j] = strings.Trim(part, "`\"")
+	}
+
+	return strings.Join(parts, "."), i, true
+}
+
+// isNamePart checks if the token at i can be (a part of) a table name, a name directly followed by a parenthesis,
+// e.g. INSERT INTO t(a), is lexed as a function name
+func isNamePart(tokens []sqllexer.Token, i int) bool {
+	if i >= len(tokens) {
+		return false
+	}
+	switch tokens[i].Type {
+	case sqllexer.IDENT, sqllexer.QUOTED_IDENT, sqllexer.FUNCTION:
+		return true
+	default:
+		return false
+	}
+}
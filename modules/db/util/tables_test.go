@@ -0,0 +1,38 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableNames(t *testing.T) {
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"SELECT * FROM t WHERE a = 1", []string{"t"}},
+		{"SELECT * FROM `db`.`t` AS a JOIN u b ON a.id = b.id", []string{"db.t", "u"}},
+		{"SELECT * FROM t1, t2 x WHERE t1.id = x.id", []string{"t1", "t2"}},
+		{"INSERT INTO t(a) SELECT a FROM u", []string{"t", "u"}},
+		{"INSERT INTO db.t(a) VALUES(1)", []string{"db.t"}},
+		{"INSERT INTO `t`(a) VALUES (1)", []string{"t"}},
+		{"INSERT t VALUES (1)", []string{"t"}},
+		{"REPLACE INTO t (a) VALUES (1)", []string{"t"}},
+		{"INSERT INTO t (a) VALUES (1) ON DUPLICATE KEY UPDATE a = 2", []string{"t"}},
+		{"UPDATE t SET a = 1", []string{"t"}},
+		{"UPDATE LOW_PRIORITY t1 JOIN t2(x) ON t1.id = t2.id SET a = 1", []string{"t1", "t2"}},
+		{"DELETE FROM t WHERE a = 1", []string{"t"}},
+		{"SELECT * FROM t WHERE a IN(SELECT a FROM u) FOR UPDATE", []string{"t", "u"}},
+		{"SELECT * FROM JSON_TABLE(x) AS j", []string{}},
+		{"CREATE TABLE IF NOT EXISTS t(id INT)", []string{"t"}},
+		{"TRUNCATE TABLE t", []string{"t"}},
+		{"RENAME TABLE a TO b", []string{"a", "b"}},
+		{"SELECT 1", []string{}},
+	}
+
+	for _, test := range tests {
+		if names := TableNames(Tokenize(test.query)); !reflect.DeepEqual(names, test.names) {
+			t.Errorf("TableNames(%q) = %v, want %v", test.query, names, test.names)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package mirror sends the copies of the queries to the mirror group in the background, the results are discarded.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"go-proxy/modules/config"
+	"go-proxy/modules/db"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Query is the copy of the query together with the session state needed to execute it
+type Query struct {
+	Query   string // Query as sent by the client
+	DbName  string // DbName is the database selected by the session
+	Charset string // Charset set by the client
+}
+
+var (
+	// queue of the mirrored queries, replaced on every start
+	queue atomic.Pointer[chan Query]
+)
+
+// Start starts the workers executing the mirrored queries until the context is canceled
+func Start(ctx context.Context) {
+	mirror := config.Config.Proxy.Mirror
+	if !mirror.IsEnabled() {
+		queue.Store(nil)
+		return
+	}
+
+	queries := make(chan Query, mirror.QueueSize)
+	queue.Store(&queries)
+
+	log.Logger.Info("Mirroring queries", zap.String("group", mirror.Group), zap.Float64("percentage", mirror.Percentage))
+	for i := 0; i < mirror.Workers; i++ {
+		go work(ctx, mirror.Group, queries)
+	}
+}
+
+// Sampled checks if the query should be mirrored by the sampled percentage
+func Sampled() bool {
+	percentage := config.Config.Proxy.Mirror.Percentage
+	return percentage > 0 && rand.Float64()*100 < percentage
+}
+
+// Send queues the query for the mirror, the query is dropped if the queue is full so the caller never waits
+func Send(query Query) {
+	queries := queue.Load()
+	if queries == nil {
+		return
+	}
+
+	select {
+	case *queries <- query:
+	default:
+		stats.Inc("mirror_dropped", "group", config.Config.Proxy.Mirror.Group)
+	}
+}
+
+func work(ctx context.Context, group string, queries chan Query) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case query := <-queries:
+			start := time.Now()
+			if err := execute(ctx, group, query); err != nil {
+				log.Logger.Debug("Mirrored query failed", zap.String("group", group), zap.String("query", query.Query), zap.Error(err))
+				stats.Inc("mirror_error", "group", group)
+				continue
+			}
+			stats.Observe("mirror_query", time.Since(start), "group", group)
+		}
+	}
+}
+
+// execute executes the query on random operational server of the group and discards the result, the connection
+// of a failed query is dropped because its state (charset, database, transaction) isn't known
+func execute(ctx context.Context, groupId string, query Query) (err error) {
+	group, found := db.Groups[groupId]
+	if !found {
+		return fmt.Errorf("mirror group %s not found", groupId)
+	}
+
+	server, err := group.GetOperationalServer()
+	if err != nil {
+		return err
+	}
+
+	conn, err := server.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			server.Pool.DropConn(conn)
+			return
+		}
+		server.Pool.PutConn(conn)
+	}()
+
+	if query.Charset != "" {
+		if _, err := conn.Execute(fmt.Sprintf("SET NAMES %s;", query.Charset)); err != nil {
+			return err
+		}
+	}
+	if query.DbName != "" {
+		if _, err := conn.Execute(fmt.Sprintf("USE %v;", query.DbName)); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Execute(query.Query)
+	return err
+}
@@ -14,6 +14,8 @@ import (
 type DbConnection struct {
 	connection *client.Conn // connection is the client connection to the MySQL server.
 	server     *db.Server   // server is the MySQL server associated with this connection.
+	group      string       // group is the ID of the group this connection was created for.
+	gtidSet    string       // gtidSet is the last gtid set known to be executed by the server of this connection.
 	charset    string       // charset used in this connection.
 	dbName     string       // dbName is the database name used in this connection.
 }
@@ -42,25 +44,38 @@ func (m *ConnectionManager) ReturnConnectionsToPool() {
 	}
 }
 
+// DropConnection closes the connection instead of returning it to the pool, used when the connection keeps a state
+// that can't be passed to other sessions.
+func (m *ConnectionManager) DropConnection(dbConn *DbConnection) {
+	log.Logger.Debug("Dropping connection", zap.String("server", dbConn.server.Config.Id))
+	dbConn.server.Pool.DropConn(dbConn.connection)
+	m.removeConnection(dbConn.group)
+}
+
 func (m *ConnectionManager) ReturnConnectionById(id string) {
 	// get server from dbConn
 	dbConn, ok := m.dbConnections[id]
 	if ok {
 		dbConn.server.Pool.PutConn(dbConn.connection)
-		delete(m.dbConnections, id)
-
-		index := -1
-		for i, k := range m.dbConnectionIds {
-			if k == id {
-				index = i
-				break
-			}
-		}
+		m.removeConnection(id)
+	}
+}
+
+// removeConnection removes the connection of the group from the manager.
+func (m *ConnectionManager) removeConnection(id string) {
+	delete(m.dbConnections, id)
 
-		if index != -1 {
-			m.dbConnectionIds = append(m.dbConnectionIds[:index], m.dbConnectionIds[index+1:]...)
+	index := -1
+	for i, k := range m.dbConnectionIds {
+		if k == id {
+			index = i
+			break
 		}
 	}
+
+	if index != -1 {
+		m.dbConnectionIds = append(m.dbConnectionIds[:index], m.dbConnectionIds[index+1:]...)
+	}
 }
 
 // getConnection retrieves a connection from the manager or creates a new one if it does not exist.
@@ -139,6 +154,7 @@ func (m *ConnectionManager) createConnection(id string, target *db.Server) (*DbC
 	dbConnection := &DbConnection{
 		connection: conn,
 		server:     target,
+		group:      id,
 	}
 
 	// Store the new connection in the manager
@@ -7,28 +7,48 @@ import (
 	"fmt"
 	"github.com/go-mysql-org/go-mysql/client"
 	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/config"
 	"go-proxy/modules/db"
 	"go-proxy/modules/db/util"
 	"go-proxy/modules/log"
+	"go-proxy/modules/mirror"
 	"go-proxy/modules/redirect"
+	"go-proxy/modules/shard"
+	"go-proxy/modules/stats"
 	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
 // ProxyHandler represents a handler for MySQL proxy queries.
 type ProxyHandler struct {
-	Id                string             // UUID of the handler
-	ctx               context.Context    // Context of the app
-	ConnectionManager *ConnectionManager // Manages the connections used by ProxyHandler
-	dbName            string             // Name of the currently selected database
-	charsetClient     string             // Charset set by the client
-	transaction       bool               // Indicates whether a transaction is ongoing
-	sendInTransaction bool               // Indicates if a query should still be sent in transaction even if transaction is false (for example COMMIT)
+	Id                   string             // UUID of the handler
+	User                 string             // Frontend user of the session
+	ctx                  context.Context    // Context of the app
+	ConnectionManager    *ConnectionManager // Manages the connections used by ProxyHandler
+	dbName               string             // Name of the currently selected database
+	schemaGroup          string             // Default group of the session set by the schema route of the database, empty if none
+	charsetClient        string             // Charset set by the client
+	transaction          bool               // Indicates whether a transaction is ongoing
+	sendInTransaction    bool               // Indicates if a query should still be sent in transaction even if transaction is false (for example COMMIT)
+	readYourWrites       bool               // Indicates if reads after a write should be pinned to the group of the write
+	lastWrite            time.Time          // Time of the last write made by the session
+	lastWriteGroup       string             // Group of the last write made by the session
+	lastWriteGtid        string             // Gtid set executed by the primary after the last write made by the session
+	lastWriteGtidUnknown bool               // The gtid set of the last write couldn't be read, reads go to the write group
+	writeInTransaction   bool               // Indicates if the ongoing transaction made a write
+	writtenTables        []string           // Tables written since the last invalidation of their cached results
+	pin                  *sessionPin        // Keeps the session on the connection holding its state
+	shardTx              shardTransaction   // Connection and shard of the ongoing transaction
 }
 
 // StmtContext represents the context of a statement, containing the connection and statement itself.
 type StmtContext struct {
-	connection *DbConnection // Connection used to prepare the statement
-	statement  *client.Stmt  // Prepared statement
+	connection      *DbConnection           // Connection used to prepare the statement
+	statement       *client.Stmt            // Prepared statement
+	query           *queryContext           // Query of the statement
+	sharded         bool                    // Indicates if the statement is routed on execution by its bound sharding key
+	shardStatements map[string]*StmtContext // Statements prepared on the other shard groups, by group ID
 }
 
 // NewProxyHandler creates a new ProxyHandler instance.
@@ -37,16 +57,42 @@ func NewProxyHandler(ctx context.Context, uuid string) *ProxyHandler {
 		Id:                uuid,
 		ctx:               ctx,
 		ConnectionManager: NewConnectionManager(ctx),
+		readYourWrites:    config.Config.Proxy.Consistency.ReadYourWrites,
+		pin:               newSessionPin(),
 	}
 }
 
+// Close returns the connections of the handler to their pools, the pinned connection is closed because its state
+// can't be passed to other sessions.
+func (h *ProxyHandler) Close() {
+	if h.pin.connection != nil {
+		h.ConnectionManager.DropConnection(h.pin.connection)
+		h.pin.reset()
+	}
+	h.ConnectionManager.ReturnConnectionsToPool()
+}
+
 // UseDB selects the specified database for subsequent queries.
 func (h *ProxyHandler) UseDB(dbName string) error {
 	log.Logger.Debug("Use DB", zap.String("handler", h.Id), zap.String("name", dbName))
-	h.dbName = dbName
+	h.selectDatabase(dbName)
 	return nil
 }
 
+// selectDatabase remembers the database of the session and the group of its schema route.
+func (h *ProxyHandler) selectDatabase(dbName string) {
+	h.dbName = dbName
+
+	group, found := config.GetSchemaRoute(dbName)
+	if !found {
+		h.schemaGroup = ""
+		return
+	}
+
+	log.Logger.Debug("Schema route found", zap.String("handler", h.Id), zap.String("database", dbName), zap.String("group", group))
+	h.schemaGroup = group
+}
+
 // HandleQuery processes a given query.
 func (h *ProxyHandler) HandleQuery(query string) (*mysql.Result, error) {
 	log.Logger.Debug("Query", zap.String("handler", h.Id), zap.String("query", query))
@@ -59,41 +105,85 @@ func (h *ProxyHandler) HandleQuery(query string) (*mysql.Result, error) {
 	}
 
 	// Analyze query content
-	h.analyzeQuery(query)
+	startsTransaction := !h.transaction
+	if handled := h.analyzeQuery(query); handled {
+		return &mysql.Result{}, nil
+	}
+	query, hint := h.findRoutingHint(query)
+	q := newQueryContext(query)
+	q.hint = hint
+	sessionStatement := util.AnalyzeSessionStatement(q.tokens)
 
 	// Find the connection that should be used
 	var dbConnection *DbConnection
-	if !h.transaction && !h.sendInTransaction {
-		normalizedQuery, hash := util.NormalizeAndHashQuery(query)
-
-		var err error
-		dbConnection, err = h.getTargetConnection(normalizedQuery, hash)
-		if err != nil {
-			return nil, err
-		}
-	} else {
+	var err error
+	switch {
+	case h.transaction || h.sendInTransaction:
 		log.Logger.Debug("Query is in the transaction", zap.String("query", query))
-		var err error
-		dbConnection, err = h.ConnectionManager.getDefaultConnection()
-		if err != nil {
-			return nil, err
+		dbConnection, err = h.getTransactionConnection(q, nil)
+	case h.pin.accepts(q, false):
+		log.Logger.Debug("Session is pinned", zap.String("handler", h.Id), zap.String("query", query))
+		dbConnection = h.pin.connection
+	case sessionStatement.CreatesState():
+		// the state has to be kept by a connection that can execute every following statement
+		log.Logger.Debug("Query pins the session", zap.String("handler", h.Id), zap.String("query", query))
+		dbConnection, err = h.getDefaultConnection()
+	default:
+		var group string
+		group, _, err = h.findTargetGroup(q, nil)
+		var scatter *scatterError
+		isScatter := errors.As(err, &scatter)
+		if err == nil || isScatter {
+			if cached, found := h.getCachedResult(q, sessionStatement); found {
+				return cached, nil
+			}
+		}
+		if isScatter {
+			merged, scatterErr := h.scatterQuery(q, scatter.groups)
+			if scatterErr == nil {
+				h.cacheResult(q, sessionStatement, merged)
+			}
+			return merged, scatterErr
+		}
+		if err == nil {
+			dbConnection, err = h.getGroupConnection(group, q)
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	// Setup connection
-	err := h.setupConnection(dbConnection)
+	err = h.setupConnection(dbConnection)
 	if err != nil {
 		log.Logger.Warn("Error setting up connection", zap.Error(err))
 		return nil, err
 	}
 
 	// Execute query
-	execute, err := dbConnection.connection.Execute(query)
+	start := time.Now()
+	execute, err := h.executeQuery(dbConnection, q)
+	h.observeSplit(q, dbConnection, time.Since(start), err)
 	if err != nil {
 		log.Logger.Warn("Error executing query: %v, reason: %v", zap.String("query", query), zap.Error(err))
 		return nil, err
 	}
 
+	// Remember the write for the read-your-writes consistency
+	h.trackWrite(dbConnection, q)
+
+	// Pin the session to the connection holding its state
+	h.pin.track(h.Id, dbConnection, sessionStatement)
+
+	// Cache the result for the next identical queries
+	h.cacheResult(q, sessionStatement, execute)
+
+	// Send the copy of the query to the mirror group, the mirror never blocks the query
+	h.mirrorQuery(q)
+
+	// Remember the statement of the transaction, the shard of the transaction is forgotten when it ends
+	h.trackTransaction(startsTransaction)
+
 	// Reset the ProxyHandler sendInTransaction flag
 	h.sendInTransaction = false
 
@@ -113,7 +203,14 @@ func (h *ProxyHandler) HandleFieldList(table string, fieldWildcard string) ([]*m
 	default:
 	}
 
-	dbConnection, err := h.ConnectionManager.getRandomConnection()
+	var dbConnection *DbConnection
+	var err error
+	if h.schemaGroup != "" {
+		// tables of the schema exist only in its group
+		dbConnection, err = h.getDefaultConnection()
+	} else {
+		dbConnection, err = h.ConnectionManager.getRandomConnection()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -137,19 +234,45 @@ func (h *ProxyHandler) HandleStmtPrepare(query string) (int, int, interface{}, e
 	}
 
 	// Find the target for the statement
+	query, hint := h.findRoutingHint(query)
+	q := newQueryContext(query)
+	q.hint = hint
 	var dbConnection *DbConnection
-	if !h.transaction && !h.sendInTransaction {
-		normalizedQuery, hash := util.NormalizeAndHashQuery(query)
-
+	sharded := false
+	if h.transaction || h.sendInTransaction {
+		log.Logger.Debug("Query is in the transaction", zap.String("query", query))
 		var err error
-		dbConnection, err = h.getTargetConnection(normalizedQuery, hash)
+		dbConnection, err = h.getTransactionConnection(q, nil)
+		if errors.Is(err, shard.ErrKeyBound) {
+			// the statement is routed on execution by the shard of the transaction, any connection can prepare it
+			sharded = true
+			dbConnection, err = h.getDefaultConnection()
+		}
 		if err != nil {
 			return 0, 0, nil, err
 		}
+	} else if h.pin.accepts(q, false) {
+		log.Logger.Debug("Session is pinned", zap.String("handler", h.Id), zap.String("query", query))
+		dbConnection = h.pin.connection
 	} else {
-		log.Logger.Debug("Query is in the transaction", zap.String("query", query))
-		var err error
-		dbConnection, err = h.ConnectionManager.getDefaultConnection()
+		group, rule, err := h.findTargetGroup(q, nil)
+		if errors.Is(err, shard.ErrKeyBound) {
+			// the statement is routed on execution, any shard can prepare it
+			shardMap, mapErr := shard.GetMap(rule.Shard.Map)
+			if mapErr != nil {
+				return 0, 0, nil, mapErr
+			}
+			group, sharded, err = shardMap.AnyGroup(), true, nil
+		}
+		var scatter *scatterError
+		if errors.As(err, &scatter) {
+			return 0, 0, nil, fmt.Errorf("%w: prepared statements have to target one shard", shard.ErrNotMergeable)
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		dbConnection, err = h.getGroupConnection(group, q)
 		if err != nil {
 			return 0, 0, nil, err
 		}
@@ -161,8 +284,11 @@ func (h *ProxyHandler) HandleStmtPrepare(query string) (int, int, interface{}, e
 	}
 
 	return stmt.ParamNum(), stmt.ColumnNum(), StmtContext{
-		connection: dbConnection,
-		statement:  stmt,
+		connection:      dbConnection,
+		statement:       stmt,
+		query:           q,
+		sharded:         sharded,
+		shardStatements: make(map[string]*StmtContext),
 	}, nil
 }
 
@@ -183,14 +309,77 @@ func (h *ProxyHandler) HandleStmtExecute(context interface{}, query string, args
 		return nil, errors.New("go-proxy error, while getting the statement context")
 	}
 
-	execute, err := stmtContext.statement.Execute(args...)
+	// sharded statements of transactions are executed by the shard of the transaction
+	inTransaction := h.transaction || h.sendInTransaction
+	if stmtContext.sharded || (inTransaction && stmtContext.query.rule != nil && stmtContext.query.rule.Shard != nil) {
+		shardContext, err := h.getShardStatement(stmtContext, args)
+		if err != nil {
+			log.Logger.Warn("Error while routing the statement", zap.String("query", query), zap.Error(err))
+			return nil, err
+		}
+		stmtContext = *shardContext
+	}
+
+	start := time.Now()
+	execute, err := h.executeWithTimeout(stmtContext.connection, stmtContext.query, func() (*mysql.Result, error) {
+		return stmtContext.statement.Execute(args...)
+	})
+	h.observeSplit(stmtContext.query, stmtContext.connection, time.Since(start), err)
 	if err != nil {
 		log.Logger.Warn("Error while executing the statement", zap.String("query", query), zap.Error(err))
+		return nil, err
+	}
+	h.trackWrite(stmtContext.connection, stmtContext.query)
+	if h.transaction {
+		h.shardTx.executed = true
 	}
 
 	return execute, nil
 }
 
+// getShardStatement returns the statement prepared on the shard of the bound sharding key, or on the shard of
+// the transaction, the statement is prepared on the shard group if it wasn't yet.
+func (h *ProxyHandler) getShardStatement(stmtContext StmtContext, args []interface{}) (*StmtContext, error) {
+	var connection *DbConnection
+	var err error
+	if h.transaction || h.sendInTransaction {
+		connection, err = h.getTransactionConnection(stmtContext.query, args)
+	} else {
+		var group string
+		if group, _, err = h.findTargetGroup(stmtContext.query, args); err == nil {
+			connection, err = h.getGroupConnection(group, stmtContext.query)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	group := connection.group
+
+	if connection == stmtContext.connection {
+		return &stmtContext, nil
+	}
+
+	shardContext, found := stmtContext.shardStatements[group]
+	if found && shardContext.connection == connection {
+		return shardContext, nil
+	}
+
+	log.Logger.Debug("Preparing statement on shard group", zap.String("handler", h.Id), zap.String("group", group))
+	stmt, err := connection.connection.Prepare(stmtContext.query.query)
+	if err != nil {
+		return nil, err
+	}
+
+	shardContext = &StmtContext{
+		connection: connection,
+		statement:  stmt,
+		query:      stmtContext.query,
+	}
+	stmtContext.shardStatements[group] = shardContext
+
+	return shardContext, nil
+}
+
 // HandleStmtClose closes a prepared statement.
 func (h *ProxyHandler) HandleStmtClose(context interface{}) error {
 	log.Logger.Debug("Stmt close")
@@ -200,11 +389,22 @@ func (h *ProxyHandler) HandleStmtClose(context interface{}) error {
 		log.Logger.Error("Error getting statement context")
 		return errors.New("go-proxy error, while getting the statement context")
 	}
+
+	for group, shardContext := range stmtContext.shardStatements {
+		if err := shardContext.statement.Close(); err != nil {
+			log.Logger.Warn("Error closing statement on shard group", zap.String("group", group), zap.Error(err))
+		}
+	}
+
 	return stmtContext.connection.connection.Close()
 }
 
 // HandleOtherCommand handles unsupported MySQL commands.
 func (h *ProxyHandler) HandleOtherCommand(cmd byte, data []byte) error {
+	if cmd == mysql.COM_RESET_CONNECTION {
+		return h.resetConnection()
+	}
+
 	log.Logger.Error("Command executed but not supported", zap.String("cmd", fmt.Sprintf("%c", cmd)))
 	return mysql.NewError(
 		mysql.ER_UNKNOWN_ERROR,
@@ -212,23 +412,188 @@ func (h *ProxyHandler) HandleOtherCommand(cmd byte, data []byte) error {
 	)
 }
 
+// resetConnection resets the session state kept by the backend, the pinned connection is closed and the next
+// queries get a clean one.
+func (h *ProxyHandler) resetConnection() error {
+	log.Logger.Debug("Reset connection", zap.String("handler", h.Id))
+	if h.pin.connection != nil {
+		h.ConnectionManager.DropConnection(h.pin.connection)
+	}
+	h.pin.reset()
+
+	return nil
+}
+
 // analyzeQuery analyzes the query, checks special queries, and sets the handler state.
-func (h *ProxyHandler) analyzeQuery(query string) {
+// Returns true if the query is handled by the proxy itself and shouldn't be sent to the server.
+func (h *ProxyHandler) analyzeQuery(query string) bool {
 	command := Analyze(query)
 	switch command.Type {
 	case SetNames:
 		log.Logger.Debug("Set names", zap.String("value", command.Value))
 		h.charsetClient = command.Value
-		return
+		return false
 	case UseDatabase:
 		log.Logger.Debug("Use database", zap.String("value", command.Value))
-		h.dbName = command.Value
-		return
+		h.selectDatabase(command.Value)
+		return false
+	case SetReadYourWrites:
+		log.Logger.Debug("Set read your writes", zap.String("handler", h.Id), zap.String("value", command.Value))
+		h.readYourWrites = isEnabledValue(command.Value)
+		return true
 	default:
 	}
 
 	// Check transaction
 	AnalyzeTransaction(h, query)
+	return false
+}
+
+// mirrorQuery sends the copy of the query to the mirror group if the rule of the query or the sampling says so,
+// queries of transactions aren't mirrored because the mirror doesn't keep the session.
+func (h *ProxyHandler) mirrorQuery(q *queryContext) {
+	mirrorConfig := config.Config.Proxy.Mirror
+	if !mirrorConfig.IsEnabled() || h.transaction || h.writeInTransaction || (q.write && !mirrorConfig.Writes) {
+		return
+	}
+
+	if (q.rule != nil && q.rule.Mirror) || mirror.Sampled() {
+		mirror.Send(mirror.Query{Query: q.query, DbName: h.dbName, Charset: h.charsetClient})
+	}
+}
+
+// trackWrite remembers when and where the session wrote, writes made in a transaction become visible on commit.
+// The cached results of the written tables are invalidated when the write becomes visible.
+func (h *ProxyHandler) trackWrite(connection *DbConnection, q *queryContext) {
+	write := q.write
+	if write && config.IsResultCacheEnabled() {
+		tables := h.queryTables(q)
+		if len(tables) == 0 {
+			// e.g. CALL, the written tables aren't known
+			tables = []string{allTables}
+		}
+		h.writtenTables = append(h.writtenTables, tables...)
+	}
+
+	if h.transaction {
+		h.writeInTransaction = h.writeInTransaction || write
+		return
+	}
+
+	if h.writeInTransaction {
+		// the transaction has just finished
+		h.writeInTransaction = false
+		write = true
+	}
+
+	if write {
+		h.lastWrite = time.Now()
+		h.lastWriteGroup = connection.group
+		h.trackGtid(connection)
+		if len(h.writtenTables) > 0 {
+			invalidateResults(h.ctx, h.writtenTables)
+			h.writtenTables = nil
+		}
+	}
+}
+
+// trackGtid remembers the gtid set of the last write. The client library (go-mysql) never sets CLIENT_SESSION_TRACK
+// in its handshake and skips the session state of the OK packet, so session_track_gtids can't be used; instead the
+// gtid_executed is read on the same connection right after the write. That set contains the write and every
+// transaction committed before it, so it's a safe causal requirement. The extra round trip is paid only by writes
+// and only when causal reads are enabled. When the set can't be read, the reads stay on the group of the write for
+// the read-your-writes window.
+func (h *ProxyHandler) trackGtid(connection *DbConnection) {
+	if config.Config.Proxy.Consistency.CausalReads == config.CausalReadsOff {
+		return
+	}
+
+	gtidSet, err := db.ExecutedGtidSet(connection.connection)
+	if err != nil {
+		log.Logger.Warn("Couldn't read the gtid of the write, reading from the write group", zap.String("handler", h.Id), zap.Error(err))
+		h.lastWriteGtid = ""
+		h.lastWriteGtidUnknown = true
+		connection.gtidSet = ""
+		return
+	}
+
+	h.lastWriteGtid = gtidSet
+	h.lastWriteGtidUnknown = false
+	connection.gtidSet = gtidSet
+}
+
+// mustReadFromWriteGroup checks if the read has to be pinned to the group of the last write of the session,
+// the read is pinned until the window passes or until the server is known to have replicated the write.
+func (h *ProxyHandler) mustReadFromWriteGroup(connection *DbConnection) bool {
+	if !h.readYourWrites || h.lastWriteGroup == "" || connection.group == h.lastWriteGroup {
+		return false
+	}
+
+	if time.Since(h.lastWrite) > config.Config.Proxy.Consistency.ReadYourWritesWindow {
+		return false
+	}
+
+	return !connection.server.HasReplicated(h.lastWrite)
+}
+
+// hasExecutedLastWrite checks if the server of the connection has executed the gtid set of the last write.
+func (h *ProxyHandler) hasExecutedLastWrite(connection *DbConnection) bool {
+	if connection.group == h.lastWriteGroup {
+		return true
+	}
+	if h.lastWriteGtidUnknown {
+		// the check can't be made, the read falls back to the write group until the read-your-writes window passes
+		// or the monitor sees the server replicated the write
+		if time.Since(h.lastWrite) <= config.Config.Proxy.Consistency.ReadYourWritesWindow && !connection.server.HasReplicated(h.lastWrite) {
+			return false
+		}
+		h.lastWriteGtidUnknown = false
+		return true
+	}
+	if h.lastWriteGtid == "" || connection.gtidSet == h.lastWriteGtid {
+		return true
+	}
+
+	var executed bool
+	switch config.Config.Proxy.Consistency.CausalReads {
+	case config.CausalReadsWait:
+		var err error
+		executed, err = db.WaitForExecutedGtidSet(connection.connection, h.lastWriteGtid, config.Config.Proxy.Consistency.CausalReadsTimeout)
+		if err != nil {
+			log.Logger.Warn("Couldn't wait for the gtid of the write", zap.String("handler", h.Id), zap.Error(err))
+		}
+	case config.CausalReadsCached:
+		executed = connection.server.HasExecuted(h.lastWriteGtid)
+	default:
+		return true
+	}
+
+	if executed {
+		connection.gtidSet = h.lastWriteGtid
+	}
+
+	return executed
+}
+
+// consistentReadConnection returns the connection of the write group if the read could miss the last write.
+func (h *ProxyHandler) consistentReadConnection(connection *DbConnection) (*DbConnection, error) {
+	if !h.mustReadFromWriteGroup(connection) && h.hasExecutedLastWrite(connection) {
+		return connection, nil
+	}
+
+	log.Logger.Debug(
+		"Read pinned to the group of the last write",
+		zap.String("handler", h.Id),
+		zap.String("group", h.lastWriteGroup),
+		zap.Time("last write", h.lastWrite),
+		zap.String("gtid", h.lastWriteGtid),
+	)
+	writeGroup, writeGroupFound := db.Groups[h.lastWriteGroup]
+	if !writeGroupFound {
+		return connection, nil
+	}
+
+	return h.ConnectionManager.getConnection(writeGroup)
 }
 
 // setupConnection sets up the connection to be compatible with the current context.
@@ -273,21 +638,163 @@ func (h *ProxyHandler) setupConnection(connection *DbConnection) error {
 	return nil
 }
 
-// getTargetGroup gets the database which should be used for the query.
-func (h *ProxyHandler) getTargetConnection(query string, hash string) (*DbConnection, error) {
-	// Find the group which should handle the query
-	targetGroup := redirect.FindRedirect(query, hash)
+// findRoutingHint finds the group requested by the routing hint in the comments of the query, the hint is ignored
+// if the user isn't allowed to use it or the group doesn't exist. Returns the query that should be sent to the server.
+func (h *ProxyHandler) findRoutingHint(query string) (string, string) {
+	hintsConfig := config.Config.Proxy.Hints
+	if !hintsConfig.Enabled {
+		return query, ""
+	}
+
+	hint, found := util.FindRoutingHint(query)
+	if !found {
+		return query, ""
+	}
+	if hintsConfig.Strip {
+		query = hint.Stripped
+	}
+
+	if !hintsConfig.AllowsUser(h.User) {
+		log.Logger.Debug("User isn't allowed to use routing hints", zap.String("handler", h.Id), zap.String("user", h.User))
+		return query, ""
+	}
+	if _, groupFound := db.Groups[hint.Group]; !groupFound {
+		log.Logger.Warn("Routing hint requests unknown group", zap.String("handler", h.Id), zap.String("group", hint.Group))
+		return query, ""
+	}
+
+	log.Logger.Debug("Routing hint found", zap.String("handler", h.Id), zap.String("group", hint.Group))
+	return query, hint.Group
+}
+
+// chooseSplit chooses the group of the rule splitting the queries, sticky rules use the same group for the session
+// or for the query digest.
+func (h *ProxyHandler) chooseSplit(rule *config.Rule, q *queryContext) string {
+	var stickyKey string
+	switch rule.Sticky {
+	case config.StickySession:
+		stickyKey = h.Id
+	case config.StickyDigest:
+		stickyKey = q.hash
+	}
+
+	split := redirect.ChooseSplit(rule, stickyKey)
+	log.Logger.Debug("Split chosen", zap.String("handler", h.Id), zap.String("rule", rule.Name), zap.String("group", split.Target))
+	return split.Target
+}
+
+// observeSplit records the latency and the errors of the split query, the group is the one the query ran on, which
+// differs from the chosen split when e.g. the write was sent to the primary or the read to the group of the last write.
+func (h *ProxyHandler) observeSplit(q *queryContext, connection *DbConnection, duration time.Duration, err error) {
+	if q.split == "" {
+		return
+	}
+
+	if err != nil {
+		stats.Inc("split_error", "rule", q.rule.Name, "group", connection.group)
+		return
+	}
+	stats.Observe("split_query", duration, "rule", q.rule.Name, "group", connection.group)
+}
+
+// getDefaultConnection gets the connection of the default group of the session, the group of the schema route
+// of the selected database or the group of the default server.
+func (h *ProxyHandler) getDefaultConnection() (*DbConnection, error) {
+	if h.schemaGroup == "" {
+		return h.ConnectionManager.getDefaultConnection()
+	}
+
+	serverGroup, groupFound := db.Groups[h.schemaGroup]
+	if !groupFound {
+		log.Logger.Debug("Schema route group not found", zap.String("group", h.schemaGroup))
+		return nil, errors.New("proxy error")
+	}
+
+	return h.ConnectionManager.getConnection(serverGroup)
+}
+
+// matchRules matches the query against the rules, the result is kept in the query context also when no rule matched
+func (h *ProxyHandler) matchRules(q *queryContext) redirect.Redirect {
+	target := redirect.FindRedirect(h.ctx, q.normalized, q.hash)
+	q.rule, q.matched = target.Rule, true
+	return target
+}
+
+// findTargetGroup finds the group which should handle the query and the rule that matched it (nil if none),
+// args are the bound parameters of the statement, nil for the text queries and the statements being prepared.
+// Reads spanning several shards return scatterError with the groups that have to execute them.
+func (h *ProxyHandler) findTargetGroup(q *queryContext, args []interface{}) (string, *config.Rule, error) {
+	if q.hint != "" {
+		return q.hint, nil, nil
+	}
+
+	target := h.matchRules(q)
+	if target.Rule == nil && h.schemaGroup != "" {
+		return h.schemaGroup, nil, nil
+	}
+	if target.Rule != nil && len(target.Rule.Split) > 0 {
+		q.split = h.chooseSplit(target.Rule, q)
+		return q.split, target.Rule, nil
+	}
+	if target.Rule == nil || target.Rule.Shard == nil {
+		return target.Group, target.Rule, nil
+	}
+
+	groups, err := shard.ResolveGroups(*target.Rule.Shard, q.tokens, args)
+	if errors.Is(err, shard.ErrKeyNotFound) && target.Rule.Target != "" {
+		log.Logger.Debug("Sharding key not found, using rule target", zap.String("handler", h.Id), zap.String("group", target.Rule.Target))
+		return target.Rule.Target, target.Rule, nil
+	}
+	if errors.Is(err, shard.ErrKeyNotFound) && !q.write && args == nil {
+		// without the key the read has to be executed by every shard
+		shardMap, mapErr := shard.GetMap(target.Rule.Shard.Map)
+		if mapErr != nil {
+			return "", target.Rule, mapErr
+		}
+		groups, err = shardMap.Groups(), nil
+	}
+	if err != nil {
+		log.Logger.Debug("Couldn't resolve the shard", zap.String("handler", h.Id), zap.String("query", q.query), zap.Error(err))
+		return "", target.Rule, err
+	}
+
+	if len(groups) > 1 {
+		if q.write || args != nil {
+			return "", target.Rule, fmt.Errorf("%w: %s", shard.ErrMultipleShards, strings.Join(groups, ", "))
+		}
+		return "", target.Rule, &scatterError{groups: groups}
+	}
+
+	return groups[0], target.Rule, nil
+}
+
+// getGroupConnection gets the connection of the group, applies the group type and the consistency of the reads.
+func (h *ProxyHandler) getGroupConnection(targetGroup string, q *queryContext) (*DbConnection, error) {
 	serverGroup, groupFound := db.Groups[targetGroup]
 	if !groupFound {
 		log.Logger.Debug("Target group not found", zap.String("group", targetGroup))
 		return nil, errors.New("proxy error")
 	}
 
+	// Writes can't be executed by replicas, even if a rule says so
+	if q.write && serverGroup.IsReplica() {
+		log.Logger.Warn(
+			"Write redirected to replica group, using default server group",
+			zap.String("handler", h.Id),
+			zap.String("query", q.normalized),
+			zap.String("group", serverGroup.Id),
+		)
+		serverGroup, groupFound = db.Groups[db.DbPool.DefaultServer.Config.ServerGroup]
+		if !groupFound {
+			return nil, errors.New("proxy error")
+		}
+	}
+
 	log.Logger.Debug(
 		"Query redirection",
-		zap.String("query", query),
+		zap.String("query", q.normalized),
 		zap.String("group", serverGroup.Id),
-		zap.String("hash", hash),
+		zap.String("hash", q.hash),
 	)
 
 	// get connection
@@ -297,5 +804,14 @@ func (h *ProxyHandler) getTargetConnection(query string, hash string) (*DbConnec
 		return nil, err
 	}
 
+	// Reads after a write have to see the write
+	if !q.write {
+		connection, err = h.consistentReadConnection(connection)
+		if err != nil {
+			log.Logger.Warn("Couldn't get needed connection", zap.String("handler", h.Id), zap.Error(err))
+			return nil, err
+		}
+	}
+
 	return connection, nil
 }
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -8,14 +9,16 @@ import (
 type CommandType int
 
 const (
-	Unknown     CommandType = iota // Unknown command type.
-	SetNames                       // SET NAMES command type.
-	UseDatabase                    // USE DATABASE command type.
+	Unknown           CommandType = iota // Unknown command type.
+	SetNames                             // SET NAMES command type.
+	UseDatabase                          // USE DATABASE command type.
+	SetReadYourWrites                    // SET GO_PROXY_READ_YOUR_WRITES proxy session command type.
 )
 
 const (
-	SetNamesPrefix = "SET NAMES"
-	UsePrefix      = "USE"
+	SetNamesPrefix          = "SET NAMES"
+	UsePrefix               = "USE"
+	SetReadYourWritesPrefix = "SET GO_PROXY_READ_YOUR_WRITES"
 )
 
 // SQLCommand represents a parsed SQL command.
@@ -38,6 +41,11 @@ func Analyze(query string) SQLCommand {
 		return command
 	}
 
+	if command, found := analyzePrefixedCommand(query, SetReadYourWritesPrefix, SetReadYourWrites); found {
+		command.Value = settingValue(command.Value)
+		return command
+	}
+
 	return SQLCommand{Type: Unknown}
 }
 
@@ -80,3 +88,22 @@ func analyzePrefixedCommand(query, prefix string, commandType CommandType) (SQLC
 
 	return SQLCommand{}, false
 }
+
+// settingValue extracts the value of a "SET name = value" command, the part after the name is given.
+func settingValue(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSuffix(value, ";")
+	value = strings.TrimSpace(value)
+	return strings.Trim(value, "'\"")
+}
+
+// isEnabledValue checks if the setting value turns the option on.
+func isEnabledValue(value string) bool {
+	switch strings.ToUpper(value) {
+	case "1", "ON", "TRUE":
+		return true
+	default:
+		return false
+	}
+}
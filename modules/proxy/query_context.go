@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"github.com/DataDog/go-sqllexer"
+	"go-proxy/modules/config"
+	"go-proxy/modules/db/util"
+)
+
+// queryContext holds the query together with everything learned about it that's needed to route it.
+type queryContext struct {
+	query      string           // query as sent by the client
+	normalized string           // normalized query, matched against the regex rules
+	hash       string           // hash of the normalized query, matched against the hash rules
+	tokens     []sqllexer.Token // tokens of the query without whitespaces and comments
+	write      bool             // indicates if the query has to be executed by a primary
+	rule       *config.Rule     // rule that matched the query, set when the query is routed
+	matched    bool             // the query was matched against the rules, rule stays nil if none of them matched
+	split      string           // group chosen by the split of the rule, empty if the rule doesn't split
+	hint       string           // group requested by the routing hint of the query, empty if none
+	resultKey  string           // cache key of the result, set when the result can be cached
+}
+
+// newQueryContext analyzes the query.
+func newQueryContext(query string) *queryContext {
+	normalized, hash := util.NormalizeAndHashQuery(query)
+	tokens := util.Tokenize(query)
+
+	return &queryContext{
+		query:      query,
+		normalized: normalized,
+		hash:       hash,
+		tokens:     tokens,
+		write:      util.IsWrite(tokens),
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/DataDog/go-sqllexer"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/cache"
+	"go-proxy/modules/config"
+	"go-proxy/modules/db/util"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultKeyPrefix separates the cached results from the cached routing decisions
+const resultKeyPrefix = "result:"
+
+// generationKeyPrefix prefixes the generations of the tables, the generation changes on every write to the table
+const generationKeyPrefix = "generation:"
+
+// allTables is the generation changed by the writes whose tables aren't known, e.g. CALL, every result depends on it
+const allTables = "*"
+
+// isResultCacheable checks if the result of the routed query can be cached, only deterministic reads of rules with
+// cache_ttl that don't depend on the state of the session or of the transaction are cached.
+func (h *ProxyHandler) isResultCacheable(q *queryContext, statement util.SessionStatement) bool {
+	return q.rule != nil && q.rule.CacheTTL > 0 && !q.write && !h.transaction && !h.sendInTransaction &&
+		h.pin.connection == nil && !statement.CreatesState() && !statement.FoundRows && util.IsDeterministic(q.tokens)
+}
+
+// getCachedResult returns the cached result of the query.
+func (h *ProxyHandler) getCachedResult(q *queryContext, statement util.SessionStatement) (*mysql.Result, bool) {
+	if !h.isResultCacheable(q, statement) {
+		return nil, false
+	}
+
+	// the key is computed before the query is executed, a write finished in the meantime changes the generation and
+	// the result can't be stored with the new one
+	key, err := h.resultKey(q)
+	if err != nil {
+		log.Logger.Debug("Result cache unavailable", zap.String("handler", h.Id), zap.Error(err))
+		return nil, false
+	}
+	q.resultKey = key
+
+	ctx, cancel := cache.WithTimeout(h.ctx)
+	defer cancel()
+	value, found, err := cache.GetCache().Get(ctx, q.resultKey)
+	if err != nil {
+		log.Logger.Debug("Result cache unavailable", zap.String("handler", h.Id), zap.Error(err))
+		return nil, false
+	}
+	if !found {
+		stats.Inc("result_cache_miss", "rule", q.rule.Name)
+		return nil, false
+	}
+
+	result, err := cache.DecodeResult(value)
+	if err != nil {
+		log.Logger.Warn("Couldn't decode the cached result", zap.String("handler", h.Id), zap.String("query", q.query), zap.Error(err))
+		stats.Inc("result_cache_miss", "rule", q.rule.Name)
+		return nil, false
+	}
+
+	log.Logger.Debug("Result found in cache", zap.String("handler", h.Id), zap.String("query", q.query))
+	stats.Inc("result_cache_hit", "rule", q.rule.Name)
+	return result, true
+}
+
+// cacheResult stores the result of the query for the cache_ttl of its rule.
+func (h *ProxyHandler) cacheResult(q *queryContext, statement util.SessionStatement, result *mysql.Result) {
+	if q.resultKey == "" || !h.isResultCacheable(q, statement) || result == nil || result.Resultset == nil {
+		return
+	}
+
+	value, err := cache.EncodeResult(result)
+	if err != nil {
+		log.Logger.Warn("Couldn't encode the result", zap.String("handler", h.Id), zap.String("query", q.query), zap.Error(err))
+		return
+	}
+	if len(value) > config.MaxCachedResultSize {
+		log.Logger.Debug("Result too large to be cached", zap.String("handler", h.Id), zap.Int("size", len(value)))
+		return
+	}
+
+	ctx, cancel := cache.WithTimeout(h.ctx)
+	defer cancel()
+	if err := cache.GetCache().SetWithTTL(ctx, q.resultKey, value, q.rule.CacheTTL); err != nil {
+		log.Logger.Debug("Result not cached", zap.String("handler", h.Id), zap.Error(err))
+	}
+}
+
+// resultKey returns the cache key of the result, the digest of the query doesn't contain the literals, so they
+// are a part of the key together with the session attributes that change the result. The key contains the current
+// generations of the tables read by the query, a write to any of them changes the key and the old result is never
+// read again. Returns an error if the generations can't be read.
+func (h *ProxyHandler) resultKey(q *queryContext) (string, error) {
+	hash := sha256.New()
+	writeKeyPart := func(part string) {
+		hash.Write(binary.AppendUvarint(nil, uint64(len(part))))
+		hash.Write([]byte(part))
+	}
+
+	writeKeyPart(q.hash)
+	writeKeyPart(h.dbName)
+	writeKeyPart(h.User)
+	writeKeyPart(h.charsetClient) // the server converts the results to the charset of the client
+	for _, token := range q.tokens {
+		switch token.Type {
+		case sqllexer.STRING, sqllexer.INCOMPLETE_STRING, sqllexer.NUMBER, sqllexer.DOLLAR_QUOTED_STRING:
+			writeKeyPart(token.Value)
+		}
+	}
+	for _, table := range append(h.queryTables(q), allTables) {
+		generation, err := tableGeneration(h.ctx, table)
+		if err != nil {
+			return "", err
+		}
+		writeKeyPart(table)
+		writeKeyPart(generation)
+	}
+
+	return resultKeyPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// queryTables returns the lowercase schema-qualified tables of the query, the tables without the schema belong to
+// the selected database.
+func (h *ProxyHandler) queryTables(q *queryContext) []string {
+	names := util.TableNames(q.tokens)
+	tables := make([]string, 0, len(names))
+	for _, name := range names {
+		if !strings.Contains(name, ".") {
+			name = h.dbName + "." + name
+		}
+		tables = append(tables, strings.ToLower(name))
+	}
+	return tables
+}
+
+// invalidateResults changes the generations of the written tables, every cached result that read them is
+// invalidated, allTables invalidates all the results.
+func invalidateResults(ctx context.Context, tables []string) {
+	slices.Sort(tables)
+	tables = slices.Compact(tables)
+	for _, table := range tables {
+		log.Logger.Debug("Invalidating cached results", zap.String("table", table))
+		if err := setGeneration(ctx, table, newGeneration()); err != nil {
+			// the results stay cached until their ttl expires
+			log.Logger.Warn("Couldn't invalidate cached results", zap.String("table", table), zap.Error(err))
+			stats.Inc("result_cache_invalidation_error")
+			continue
+		}
+		stats.Inc("result_cache_invalidation")
+	}
+}
+
+// tableGeneration returns the current generation of the table, the missing generation (never written or evicted)
+// is replaced by a new one, so the results cached with the previous generation can't be read.
+func tableGeneration(ctx context.Context, table string) (string, error) {
+	callCtx, cancel := cache.WithTimeout(ctx)
+	defer cancel()
+	generation, found, err := cache.GetCache().Get(callCtx, generationKeyPrefix+table)
+	if err != nil || found {
+		return generation, err
+	}
+
+	generation = newGeneration()
+	return generation, setGeneration(ctx, table, generation)
+}
+
+func setGeneration(ctx context.Context, table string, generation string) error {
+	ctx, cancel := cache.WithTimeout(ctx)
+	defer cancel()
+	return cache.GetCache().Set(ctx, generationKeyPrefix+table, generation)
+}
+
+// newGeneration returns a generation unique across the proxies sharing the cache
+func newGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/log"
+	"go-proxy/modules/shard"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scatterError is returned by findTargetGroup when the read has to be executed by several shard groups.
+type scatterError struct {
+	groups []string // groups that have to execute the read
+}
+
+func (e *scatterError) Error() string {
+	return fmt.Sprintf("query spans shard groups %s", strings.Join(e.groups, ", "))
+}
+
+// scatterQuery executes the read by every group in parallel and merges the results.
+func (h *ProxyHandler) scatterQuery(q *queryContext, groups []string) (*mysql.Result, error) {
+	plan, err := shard.PlanMerge(q.tokens)
+	if err != nil {
+		log.Logger.Debug("Query can't be scattered", zap.String("handler", h.Id), zap.String("query", q.query), zap.Error(err))
+		return nil, err
+	}
+
+	// connections are taken one by one, the connection manager isn't safe for concurrent use
+	connections := make([]*DbConnection, len(groups))
+	used := make(map[*DbConnection]string)
+	for i, group := range groups {
+		connection, err := h.getGroupConnection(group, q)
+		if err != nil {
+			return nil, err
+		}
+		if other, found := used[connection]; found {
+			// e.g. the read was pinned to the group of the last write, the shards would return the same rows
+			return nil, fmt.Errorf("%w: shard groups %s and %s use the same connection", shard.ErrNotMergeable, other, group)
+		}
+		used[connection] = group
+
+		if err := h.setupConnection(connection); err != nil {
+			log.Logger.Warn("Error setting up connection", zap.Error(err))
+			return nil, err
+		}
+		connections[i] = connection
+	}
+
+	log.Logger.Debug("Scattering query", zap.String("handler", h.Id), zap.String("query", q.query), zap.Strings("groups", groups))
+	start := time.Now()
+
+	results := make([]*mysql.Result, len(connections))
+	errs := make([]error, len(connections))
+	var wg sync.WaitGroup
+	for i, connection := range connections {
+		wg.Add(1)
+		go func(i int, connection *DbConnection) {
+			defer wg.Done()
+			results[i], errs[i] = connection.connection.Execute(q.query)
+		}(i, connection)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			log.Logger.Warn("Error executing query on shard group", zap.String("query", q.query), zap.String("group", groups[i]), zap.Error(err))
+			return nil, err
+		}
+	}
+
+	merged, err := plan.Merge(results)
+	if err != nil {
+		log.Logger.Warn("Error merging the results of the shards", zap.String("query", q.query), zap.Error(err))
+		return nil, err
+	}
+
+	stats.Observe("scatter_query", time.Since(start), "groups", strconv.Itoa(len(groups)))
+	h.sendInTransaction = false
+
+	return merged, nil
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"go-proxy/modules/db"
+	"go-proxy/modules/db/util"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+)
+
+// sessionPin keeps the session on one backend connection while the connection holds a state of the session,
+// e.g. table locks, named locks, temporary tables, user variables or prepared statements.
+type sessionPin struct {
+	connection    *DbConnection   // connection holding the state, nil if the session isn't pinned
+	lockTables    bool            // lockTables is set while LOCK TABLES is in effect
+	namedLocks    int             // namedLocks is the number of GET_LOCK() calls not released yet
+	tempTables    map[string]bool // tempTables are the temporary tables created by the session
+	userVariables map[string]bool // userVariables are the user variables set by the session
+	prepared      map[string]bool // prepared are the statements prepared by PREPARE in SQL
+	foundRows     bool            // foundRows is set until the statement after SQL_CALC_FOUND_ROWS
+}
+
+// newSessionPin creates the pin of a session that isn't pinned.
+func newSessionPin() *sessionPin {
+	return &sessionPin{
+		tempTables:    make(map[string]bool),
+		userVariables: make(map[string]bool),
+		prepared:      make(map[string]bool),
+	}
+}
+
+// isActive checks if any state is kept by the pinned connection.
+func (p *sessionPin) isActive() bool {
+	return p.lockTables || p.namedLocks > 0 || len(p.tempTables) > 0 || len(p.userVariables) > 0 ||
+		len(p.prepared) > 0 || p.foundRows
+}
+
+// accepts checks if the query can be sent to the pinned connection, writes and transactions can't be executed
+// by a replica connection, which can be pinned only by SQL_CALC_FOUND_ROWS.
+func (p *sessionPin) accepts(q *queryContext, transaction bool) bool {
+	if p.connection == nil {
+		return false
+	}
+
+	group, found := db.Groups[p.connection.group]
+	return !found || !group.IsReplica() || (!q.write && !transaction)
+}
+
+// track updates the state kept by the connection after the statement was executed by it, the session is pinned
+// to the connection while any state is kept and released when the last one is gone.
+func (p *sessionPin) track(handlerId string, connection *DbConnection, statement util.SessionStatement) {
+	if p.connection != nil && p.connection != connection {
+		// only the pin of SQL_CALC_FOUND_ROWS can be bypassed and the statement after it releases it
+		p.foundRows = false
+		p.releaseIfDone(handlerId)
+		if p.connection != nil {
+			return
+		}
+	}
+
+	p.foundRows = statement.FoundRows
+	if statement.LockTables {
+		p.lockTables = true
+	}
+	if statement.UnlockTables {
+		p.lockTables = false
+	}
+	p.namedLocks = max(p.namedLocks+statement.NamedLocks-statement.ReleasedLocks, 0)
+	if statement.ReleaseAllLocks {
+		p.namedLocks = 0
+	}
+	for _, table := range statement.CreatedTemporaryTables {
+		p.tempTables[table] = true
+	}
+	for _, table := range statement.DroppedTables {
+		delete(p.tempTables, table)
+	}
+	for _, variable := range statement.SetVariables {
+		p.userVariables[variable] = true
+	}
+	for _, variable := range statement.ClearedVariables {
+		delete(p.userVariables, variable)
+	}
+	for _, name := range statement.Prepared {
+		p.prepared[name] = true
+	}
+	for _, name := range statement.Deallocated {
+		delete(p.prepared, name)
+	}
+
+	if p.connection == nil && p.isActive() {
+		log.Logger.Debug(
+			"Session pinned to the connection",
+			zap.String("handler", handlerId),
+			zap.String("group", connection.group),
+			zap.String("server", connection.server.Config.Id),
+		)
+		p.connection = connection
+	}
+
+	p.releaseIfDone(handlerId)
+}
+
+// releaseIfDone releases the pin when the connection doesn't keep any state of the session.
+func (p *sessionPin) releaseIfDone(handlerId string) {
+	if p.connection == nil || p.isActive() {
+		return
+	}
+
+	log.Logger.Debug("Session pin released", zap.String("handler", handlerId), zap.String("group", p.connection.group))
+	p.connection = nil
+}
+
+// reset forgets the whole state, used when the session is reset.
+func (p *sessionPin) reset() {
+	*p = *newSessionPin()
+}
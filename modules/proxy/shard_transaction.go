@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"go-proxy/modules/db"
+	"go-proxy/modules/log"
+	"go-proxy/modules/shard"
+	"go.uber.org/zap"
+)
+
+// shardTransaction binds the transaction of the session to the shard of its first sharded statement, every statement
+// of the transaction has to be executed by the same connection.
+type shardTransaction struct {
+	begin      string        // statement that started the transaction, repeated when the transaction moves to its shard
+	connection *DbConnection // connection running the transaction, nil until its first statement
+	group      string        // shard group the transaction is bound to, empty until its first sharded statement
+	executed   bool          // statements besides the begin were executed, the transaction can't move to another group
+}
+
+// getTransactionConnection gets the connection running the transaction. The transaction starts on the connection
+// of the pinned session or on the default one and it moves to the shard of its first sharded statement if nothing but
+// the begin was executed yet. Sharded statements whose shard can't be resolved or differs from the shard
+// of the transaction get an error. args are the bound parameters of the statement, nil for the text queries.
+func (h *ProxyHandler) getTransactionConnection(q *queryContext, args []interface{}) (*DbConnection, error) {
+	group, err := h.transactionShard(q, args)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &h.shardTx
+	if tx.connection == nil {
+		if h.pin.accepts(q, true) {
+			tx.connection = h.pin.connection
+		} else if tx.connection, err = h.getDefaultConnection(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case group == "":
+		return tx.connection, nil
+	case group == tx.connection.group:
+		tx.group = group
+		return tx.connection, nil
+	case tx.group != "":
+		return nil, fmt.Errorf("%w: the transaction runs on %s, the statement belongs to %s", shard.ErrTransactionShard, tx.group, group)
+	case tx.executed:
+		return nil, fmt.Errorf("%w: the transaction already executed statements on %s, the statement belongs to %s",
+			shard.ErrTransactionShard, tx.connection.group, group)
+	}
+
+	return h.moveTransaction(group)
+}
+
+// transactionShard returns the shard group of the statement in the transaction, empty if the statement isn't sharded.
+// The target of the rule is used when the sharding key isn't found in the statement.
+func (h *ProxyHandler) transactionShard(q *queryContext, args []interface{}) (string, error) {
+	if q.hint != "" {
+		return "", nil
+	}
+
+	target := h.matchRules(q)
+	if target.Rule == nil || target.Rule.Shard == nil {
+		return "", nil
+	}
+
+	group, err := shard.ResolveGroup(*target.Rule.Shard, q.tokens, args)
+	if errors.Is(err, shard.ErrKeyNotFound) && target.Rule.Target != "" {
+		return target.Rule.Target, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return group, nil
+}
+
+// moveTransaction moves the transaction that hasn't executed anything but the begin to the shard group, the begin
+// is repeated on the connection of the group and the empty transaction is rolled back
+func (h *ProxyHandler) moveTransaction(group string) (*DbConnection, error) {
+	serverGroup, groupFound := db.Groups[group]
+	if !groupFound {
+		log.Logger.Debug("Shard group not found", zap.String("group", group))
+		return nil, errors.New("proxy error")
+	}
+	connection, err := h.ConnectionManager.getConnection(serverGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &h.shardTx
+	if tx.begin != "" {
+		log.Logger.Debug("Moving the transaction to its shard", zap.String("handler", h.Id), zap.String("from", tx.connection.group), zap.String("to", group))
+		if _, err := tx.connection.connection.Execute("ROLLBACK"); err != nil {
+			return nil, err
+		}
+		if _, err := connection.connection.Execute(tx.begin); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.connection = connection
+	tx.group = group
+	return connection, nil
+}
+
+// trackTransaction remembers that the statement was executed in the transaction, the binding is reset when
+// the transaction ends
+func (h *ProxyHandler) trackTransaction(startsTransaction bool) {
+	switch {
+	case !h.transaction:
+		h.shardTx = shardTransaction{}
+	case !startsTransaction:
+		h.shardTx.executed = true
+	}
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go-proxy/modules/stats"
+	"go.uber.org/zap"
+	"time"
+)
+
+// killTimeout limits the side connection killing the timed out query
+const killTimeout = 5 * time.Second
+
+// executeQuery executes the query on the connection within the timeout of its rule, see executeWithTimeout.
+func (h *ProxyHandler) executeQuery(connection *DbConnection, q *queryContext) (*mysql.Result, error) {
+	return h.executeWithTimeout(connection, q, func() (*mysql.Result, error) {
+		return connection.connection.Execute(q.query)
+	})
+}
+
+// executeWithTimeout runs the execution of the query (text query or prepared statement) on the connection, when
+// the timeout of the rule passes the query is killed on the server and the connection is dropped instead of being
+// returned to the pool. A transaction running on the dropped connection is rolled back by the server.
+func (h *ProxyHandler) executeWithTimeout(connection *DbConnection, q *queryContext, execute func() (*mysql.Result, error)) (*mysql.Result, error) {
+	rule := h.timeoutRule(q)
+	if rule == nil || rule.Timeout <= 0 {
+		return execute()
+	}
+
+	type outcome struct {
+		result *mysql.Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := execute()
+		done <- outcome{result: result, err: err}
+	}()
+
+	timer := time.NewTimer(rule.Timeout)
+	defer timer.Stop()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+	}
+
+	log.Logger.Warn(
+		"Query timed out, killing it",
+		zap.String("handler", h.Id),
+		zap.String("rule", rule.Name),
+		zap.String("server", connection.server.Config.Id),
+		zap.Uint32("connection id", connection.connection.GetConnectionID()),
+		zap.Duration("timeout", rule.Timeout),
+	)
+	stats.Inc("query_timeout", "rule", rule.Name)
+
+	ctx, cancel := context.WithTimeout(h.ctx, killTimeout)
+	defer cancel()
+	if err := connection.server.KillQuery(ctx, connection.connection.GetConnectionID()); err != nil {
+		log.Logger.Warn("Couldn't kill the query", zap.String("handler", h.Id), zap.Error(err))
+	}
+
+	// the connection can be in any state now, closing it also stops the query if the kill failed
+	if h.pin.connection == connection {
+		h.pin.reset()
+	}
+	h.ConnectionManager.DropConnection(connection)
+	if h.transaction {
+		log.Logger.Warn("Transaction rolled back by the query timeout", zap.String("handler", h.Id))
+		h.transaction = false
+		h.writeInTransaction = false
+		h.shardTx = shardTransaction{}
+	}
+	<-done
+
+	return nil, mysql.NewError(
+		mysql.ER_QUERY_INTERRUPTED,
+		fmt.Sprintf("query execution was interrupted, timeout %v of rule %s exceeded", rule.Timeout, rule.Name),
+	)
+}
+
+// timeoutRule returns the rule whose timeout limits the query. The queries that weren't routed by the rules (pinned,
+// in the transaction or with a routing hint) are matched against them only to find the timeout, the queries already
+// matched reuse the result even if no rule matched them.
+func (h *ProxyHandler) timeoutRule(q *queryContext) *config.Rule {
+	if q.matched || !hasRuleTimeouts() {
+		return q.rule
+	}
+	return h.matchRules(q).Rule
+}
+
+// hasRuleTimeouts checks if any rule limits the time of its queries
+func hasRuleTimeouts() bool {
+	for _, rule := range config.Config.Proxy.Rules {
+		if rule.Timeout > 0 {
+			return true
+		}
+	}
+	return false
+}
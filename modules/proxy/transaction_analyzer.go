@@ -38,6 +38,7 @@ func handleBeginTransaction(proxy *ProxyHandler, query string) {
 	log.Logger.Debug("Begin Transaction", zap.String("query", query))
 	proxy.transaction = true
 	proxy.sendInTransaction = true
+	proxy.shardTx = shardTransaction{begin: query}
 }
 
 // handleCommit handles the commit of a transaction.
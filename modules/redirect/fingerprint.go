@@ -0,0 +1,38 @@
+package redirect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go-proxy/modules/config"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// rulesFingerprint identifies the rule set the cached routing decisions were made with
+var rulesFingerprint string
+
+// BuildFingerprint computes the fingerprint of the rules, a changed rule set uses new cache keys, so the decisions
+// of the previous configuration are never read and proxies with different rules can share the cache
+func BuildFingerprint() {
+	rulesFingerprint = computeFingerprint(config.Config.Proxy.Rules)
+	log.Logger.Debug("Rules fingerprint", zap.String("fingerprint", rulesFingerprint))
+}
+
+// Fingerprint returns the fingerprint of the current rule set
+func Fingerprint() string {
+	return rulesFingerprint
+}
+
+// computeFingerprint hashes the whole configuration of the rules, the cached values point to the rules by their
+// position, so the order matters too
+func computeFingerprint(rules []config.Rule) string {
+	encoded, err := yaml.Marshal(rules)
+	if err != nil {
+		log.Logger.Warn("Couldn't encode the rules for the fingerprint", zap.Error(err))
+		return ""
+	}
+
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:8])
+}
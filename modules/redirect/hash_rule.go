@@ -2,33 +2,43 @@ package redirect
 
 import (
 	"go-proxy/modules/config"
+	"time"
 )
 
 type HashRule struct {
 	Rule        config.Rule
+	Index       int // position of the rule in the configuration
 	TargetGroup string
 }
 
 var (
-	HashRules map[string]HashRule
+	// HashRules are the rules of the hash in the order of the configuration, scheduled rules can share the hash
+	HashRules map[string][]HashRule
 )
 
 func init() {
-	HashRules = make(map[string]HashRule)
+	HashRules = make(map[string][]HashRule)
 }
 
 func BuildHashRules() {
-	for _, rule := range config.Config.Proxy.Rules {
+	HashRules = make(map[string][]HashRule)
+	for i, rule := range config.Config.Proxy.Rules {
 		if rule.Hash != "" {
-			HashRules[rule.Hash] = HashRule{
+			HashRules[rule.Hash] = append(HashRules[rule.Hash], HashRule{
 				Rule:        rule,
+				Index:       i,
 				TargetGroup: rule.Target,
-			}
+			})
 		}
 	}
 }
 
-func FindHashRule(hash string) (HashRule, bool) {
-	rule, ok := HashRules[hash]
-	return rule, ok
+// FindHashRule finds the first rule of the hash that is active at the time
+func FindHashRule(hash string, now time.Time) (HashRule, bool) {
+	for _, rule := range HashRules[hash] {
+		if isRuleActive(rule.Index, now) {
+			return rule, true
+		}
+	}
+	return HashRule{}, false
 }
@@ -1,46 +1,121 @@
 package redirect
 
 import (
+	"context"
 	"go-proxy/modules/cache"
+	"go-proxy/modules/config"
 	"go-proxy/modules/db"
 	"go-proxy/modules/log"
 	"go.uber.org/zap"
+	"strconv"
+	"time"
 )
 
+// noRule is cached when none of the rules matched the query
+const noRule = "-"
+
+// Redirect is the result of the rule matching
+type Redirect struct {
+	Rule  *config.Rule // Rule that matched the query, nil if none of the rules matched
+	Group string       // Group is the target of the rule or the default group, sharded rules resolve it from the query
+}
+
 // BuildRules builds the additional structures for the redirect rules
 func BuildRules() {
 	BuildRegexRules()
 	BuildHashRules()
+	BuildSchedules()
+	BuildFingerprint()
 }
 
-// FindRedirect finds the first (hash then regex) rule that matches the util
-func FindRedirect(query string, hash string) string {
+// FindRedirect finds the first (hash then regex) rule that matches the util,
+// the cache stores the position of the matched rule, the rules are matched when the cache can't be used
+func FindRedirect(ctx context.Context, query string, hash string) Redirect {
+	now := time.Now()
+	key, ttl := routingKey(hash, now)
+
 	// first search in cache
-	cachedServer, foundInCache := cache.GetCache().Get(hash)
+	cachedRule, foundInCache, err := getRoutingDecision(ctx, key)
+	if err != nil {
+		log.Logger.Debug("Routing cache error, matching the rules", zap.String("key", key), zap.Error(err))
+	}
 	if foundInCache {
-		return cachedServer
+		if redirect, valid := decodeRedirect(cachedRule); valid {
+			return redirect
+		}
 	}
 
 	// search in hash rules
-	hashRule, hashRuleHit := FindHashRule(hash)
+	hashRule, hashRuleHit := FindHashRule(hash, now)
 	if hashRuleHit {
 		log.Logger.Debug("Hash rule found", zap.String("query", query))
-		cache.GetCache().Set(hash, hashRule.TargetGroup)
-		return hashRule.TargetGroup
+		setRoutingDecision(ctx, key, strconv.Itoa(hashRule.Index), ttl)
+		return newRedirect(hashRule.Index)
 	}
 
 	// if none of the hash rules match, then check the regex rules
-	regexRule, regexRuleHit := FindRegexRule(query)
+	regexRule, regexRuleHit := FindRegexRule(query, now)
 	if regexRuleHit {
 		log.Logger.Debug("Regex rule found", zap.String("query", query))
-		cache.GetCache().Set(hash, regexRule.TargetGroup)
-		return regexRule.TargetGroup
+		setRoutingDecision(ctx, key, strconv.Itoa(regexRule.Index), ttl)
+		return newRedirect(regexRule.Index)
 	}
 
 	// add hash to cache
 	log.Logger.Debug("No rule found, use default server", zap.String("query", query))
-	cache.GetCache().Set(hash, db.DbPool.DefaultServer.Config.ServerGroup)
+	setRoutingDecision(ctx, key, noRule, ttl)
 
 	// if none of the rules matched then return the default db
-	return db.DbPool.DefaultServer.Config.ServerGroup
+	return defaultRedirect()
+}
+
+// getRoutingDecision reads the cached decision within the cache timeout
+func getRoutingDecision(ctx context.Context, key string) (string, bool, error) {
+	ctx, cancel := cache.WithTimeout(ctx)
+	defer cancel()
+	return cache.GetCache().Get(ctx, key)
+}
+
+// setRoutingDecision caches the decision, the decisions of a schedule period expire at its end
+func setRoutingDecision(ctx context.Context, key string, value string, ttl time.Duration) {
+	ctx, cancel := cache.WithTimeout(ctx)
+	defer cancel()
+
+	var err error
+	if ttl > 0 {
+		err = cache.GetCache().SetWithTTL(ctx, key, value, ttl)
+	} else {
+		err = cache.GetCache().Set(ctx, key, value)
+	}
+	if err != nil {
+		log.Logger.Debug("Routing decision not cached", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func newRedirect(index int) Redirect {
+	rule := &config.Config.Proxy.Rules[index]
+	return Redirect{
+		Rule:  rule,
+		Group: rule.Target,
+	}
+}
+
+func defaultRedirect() Redirect {
+	return Redirect{
+		Group: db.DbPool.DefaultServer.Config.ServerGroup,
+	}
+}
+
+// decodeRedirect decodes the cached value, values that don't point to an existing rule are invalid
+func decodeRedirect(value string) (Redirect, bool) {
+	if value == noRule {
+		return defaultRedirect(), true
+	}
+
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 || index >= len(config.Config.Proxy.Rules) {
+		return Redirect{}, false
+	}
+
+	return newRedirect(index), true
 }
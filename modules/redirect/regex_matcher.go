@@ -0,0 +1,365 @@
+package redirect
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxRuleLiterals limits the number of literals computed for one rule, rules with more are always checked
+const maxRuleLiterals = 64
+
+// RegexMatcher finds the first matching regex rule. Every rule is prefiltered by the literals one of which has to
+// appear in its match (found for all the rules by a single pass over the query) and by the literal prefixes its
+// anchored matches start with, so only a few regular expressions run for every query.
+type RegexMatcher struct {
+	rules    []RegexRule
+	filters  []ruleFilter
+	literals *literalAutomaton // finds the required literals of all the rules in the query
+	owners   [][]int           // positions of the rules by the index of the literal
+	always   []int             // positions of the rules without required literals, checked for every query
+}
+
+// ruleFilter is what every match of the rule has to satisfy, all texts are lowercase
+type ruleFilter struct {
+	prefixes []string // the match starts the query with one of the prefixes, nil if the rule isn't anchored
+}
+
+// NewRegexMatcher builds the matcher of the rules, the order of the rules decides which one matches first
+func NewRegexMatcher(rules []RegexRule) *RegexMatcher {
+	matcher := &RegexMatcher{
+		rules:   rules,
+		filters: make([]ruleFilter, len(rules)),
+	}
+
+	literalIds := make(map[string]int)
+	keys := make([]string, 0)
+	for position, rule := range rules {
+		re, err := syntax.Parse(rule.Pattern, syntax.Perl)
+		if err != nil {
+			matcher.always = append(matcher.always, position)
+			continue
+		}
+		re = re.Simplify()
+
+		if prefixes, anchored, _ := literalPrefixes(re); anchored && isFoldable(prefixes) {
+			matcher.filters[position].prefixes = lowerAll(prefixes)
+		}
+
+		literals := requiredLiterals(re)
+		if literals == nil || shortestLength(literals) == 0 {
+			matcher.always = append(matcher.always, position)
+			continue
+		}
+		for _, literal := range literals {
+			id, found := literalIds[literal]
+			if !found {
+				id = len(keys)
+				literalIds[literal] = id
+				keys = append(keys, literal)
+				matcher.owners = append(matcher.owners, nil)
+			}
+			matcher.owners[id] = append(matcher.owners[id], position)
+		}
+	}
+	matcher.literals = newLiteralAutomaton(keys)
+
+	return matcher
+}
+
+// Find returns the first rule, in the order of the rules, that matches the query, rules not accepted by the accept
+// function are skipped (nil accepts every rule)
+func (m *RegexMatcher) Find(query string, accept func(RegexRule) bool) (RegexRule, bool) {
+	lower := foldQuery(query)
+	for _, position := range m.candidates(lower) {
+		if !m.filters[position].accepts(lower) || (accept != nil && !accept(m.rules[position])) {
+			continue
+		}
+		if m.rules[position].Match(query) {
+			return m.rules[position], true
+		}
+	}
+
+	return RegexRule{}, false
+}
+
+// candidates returns the ordered positions of the rules whose required literals appear in the lowercase query
+func (m *RegexMatcher) candidates(lower string) []int {
+	ids := make([]int, 0, 8)
+	m.literals.find(lower, func(id int) {
+		ids = append(ids, id)
+	})
+	sort.Ints(ids)
+
+	candidates := make([]int, 0, len(m.always)+len(ids))
+	candidates = append(candidates, m.always...)
+	for i, id := range ids {
+		// the literal can occur several times
+		if i == 0 || id != ids[i-1] {
+			candidates = append(candidates, m.owners[id]...)
+		}
+	}
+
+	sort.Ints(candidates)
+
+	// a rule with several literals can be found more than once
+	unique := candidates[:0]
+	for i, position := range candidates {
+		if i == 0 || position != candidates[i-1] {
+			unique = append(unique, position)
+		}
+	}
+
+	return unique
+}
+
+// accepts checks if the lowercase query starts with one of the prefixes of the anchored rule
+func (f ruleFilter) accepts(lower string) bool {
+	if f.prefixes == nil {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredLiterals returns the literals at least one of which appears in every match of the expression,
+// nil if there are no such literals. The literals are lowercase, the query is folded before it's searched.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal := string(re.Rune)
+		if !isFoldable([]string{literal}) {
+			return nil
+		}
+		return []string{strings.ToLower(literal)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpAlternate:
+		literals := make([]string, 0, len(re.Sub))
+		for _, sub := range re.Sub {
+			subLiterals := requiredLiterals(sub)
+			if subLiterals == nil {
+				return nil
+			}
+			literals = append(literals, subLiterals...)
+		}
+		if len(literals) > maxRuleLiterals {
+			return nil
+		}
+		return literals
+	case syntax.OpConcat:
+		// every part is required, the most selective one is used
+		var best []string
+		for _, sub := range re.Sub {
+			if literals := requiredLiterals(sub); literals != nil && isMoreSelective(literals, best) {
+				best = literals
+			}
+		}
+		return best
+	default:
+		return nil
+	}
+}
+
+// isMoreSelective compares the literal sets by their shortest literal, then by their size
+func isMoreSelective(literals []string, than []string) bool {
+	if than == nil {
+		return true
+	}
+	shortest, thanShortest := shortestLength(literals), shortestLength(than)
+	if shortest != thanShortest {
+		return shortest > thanShortest
+	}
+	return len(literals) < len(than)
+}
+
+func shortestLength(literals []string) int {
+	shortest := -1
+	for _, literal := range literals {
+		if shortest == -1 || len(literal) < shortest {
+			shortest = len(literal)
+		}
+	}
+	return shortest
+}
+
+// literalPrefixes returns the literal texts that every match of the expression starts with, anchored tells if the
+// expression is anchored to the beginning of the text and complete if the prefixes cover the whole expression
+func literalPrefixes(re *syntax.Regexp) (prefixes []string, anchored bool, complete bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, false, true
+	case syntax.OpBeginText:
+		return []string{""}, true, true
+	case syntax.OpEmptyMatch:
+		return []string{""}, false, true
+	case syntax.OpCapture:
+		return literalPrefixes(re.Sub[0])
+	case syntax.OpAlternate:
+		anchored, complete = true, true
+		for _, sub := range re.Sub {
+			subPrefixes, subAnchored, subComplete := literalPrefixes(sub)
+			prefixes = append(prefixes, subPrefixes...)
+			anchored = anchored && subAnchored
+			complete = complete && subComplete
+		}
+		if len(prefixes) > maxRuleLiterals {
+			return nil, false, false
+		}
+		return prefixes, anchored, complete
+	case syntax.OpConcat:
+		prefixes = []string{""}
+		for i, sub := range re.Sub {
+			subPrefixes, subAnchored, subComplete := literalPrefixes(sub)
+			if i == 0 {
+				anchored = subAnchored
+			}
+
+			combined := make([]string, 0, len(prefixes)*len(subPrefixes))
+			for _, prefix := range prefixes {
+				for _, subPrefix := range subPrefixes {
+					combined = append(combined, prefix+subPrefix)
+				}
+			}
+			if len(combined) == 0 || len(combined) > maxRuleLiterals {
+				return prefixes, anchored, false
+			}
+			prefixes = combined
+
+			if !subComplete {
+				return prefixes, anchored, false
+			}
+		}
+		return prefixes, anchored, true
+	default:
+		return []string{""}, false, false
+	}
+}
+
+// foldQuery lowercases the query, the non-ASCII letters that the case-insensitive regular expressions match with
+// ASCII letters are mapped to them
+func foldQuery(query string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\u212a': // Kelvin sign
+			return 'k'
+		case '\u017f': // long s
+			return 's'
+		default:
+			return unicode.ToLower(r)
+		}
+	}, query)
+}
+
+// isFoldable checks if the texts can be compared case-insensitively by lowercasing, case folding of non-ASCII
+// letters differs from strings.ToLower
+func isFoldable(texts []string) bool {
+	if len(texts) == 0 {
+		return false
+	}
+	for _, text := range texts {
+		for i := 0; i < len(text); i++ {
+			if text[i] >= utf8.RuneSelf {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func lowerAll(texts []string) []string {
+	lower := make([]string, len(texts))
+	for i, text := range texts {
+		lower[i] = strings.ToLower(text)
+	}
+	return lower
+}
+
+// literalAutomaton is the Aho-Corasick automaton finding all the literals in the text in a single pass
+type literalAutomaton struct {
+	next    []map[byte]int // transitions of the trie
+	fail    []int          // longest proper suffix of the state that is also a state
+	outputs [][]int        // literals ending in the state, including the ones of the fail states
+}
+
+func newLiteralAutomaton(literals []string) *literalAutomaton {
+	a := &literalAutomaton{
+		next:    []map[byte]int{{}},
+		fail:    []int{0},
+		outputs: [][]int{nil},
+	}
+
+	for id, literal := range literals {
+		state := 0
+		for i := 0; i < len(literal); i++ {
+			child, found := a.next[state][literal[i]]
+			if !found {
+				child = len(a.next)
+				a.next = append(a.next, map[byte]int{})
+				a.fail = append(a.fail, 0)
+				a.outputs = append(a.outputs, nil)
+				a.next[state][literal[i]] = child
+			}
+			state = child
+		}
+		a.outputs[state] = append(a.outputs[state], id)
+	}
+
+	// breadth-first computation of the fail links
+	queue := make([]int, 0, len(a.next))
+	for _, child := range a.next[0] {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range a.next[state] {
+			fail := a.fail[state]
+			for {
+				if target, found := a.next[fail][b]; found && target != child {
+					a.fail[child] = target
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.fail[fail]
+			}
+			a.outputs[child] = append(a.outputs[child], a.outputs[a.fail[child]]...)
+			queue = append(queue, child)
+		}
+	}
+
+	return a
+}
+
+// find calls found with the index of every literal occurrence in the text
+func (a *literalAutomaton) find(text string, found func(id int)) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		for {
+			if target, ok := a.next[state][text[i]]; ok {
+				state = target
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = a.fail[state]
+		}
+		for _, id := range a.outputs[state] {
+			found(id)
+		}
+	}
+}
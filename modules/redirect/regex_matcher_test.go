@@ -0,0 +1,107 @@
+package redirect
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var benchmarkRuleCounts = []int{10, 100, 1000}
+
+// findRegexRuleSequentially checks the rules one by one, it's the reference the matcher is compared with
+func findRegexRuleSequentially(rules []RegexRule, query string) (RegexRule, bool) {
+	for _, regexRule := range rules {
+		if regexRule.Match(query) {
+			return regexRule, true
+		}
+	}
+
+	return RegexRule{}, false
+}
+
+func TestRegexMatcherFind(t *testing.T) {
+	for _, count := range benchmarkRuleCounts {
+		rules := benchmarkRules(count)
+		matcher := NewRegexMatcher(rules)
+
+		for _, query := range benchmarkQueries(count, 1000) {
+			expected, expectedFound := findRegexRuleSequentially(rules, query)
+			found, ruleFound := matcher.Find(query, nil)
+			if expectedFound != ruleFound || expected.Index != found.Index {
+				t.Errorf("%d rules: matcher found rule %d (%v) instead of %d (%v) for %q",
+					count, found.Index, ruleFound, expected.Index, expectedFound, query)
+			}
+		}
+	}
+}
+
+// BenchmarkRegexRules compares the matcher with checking the generated rules one by one
+func BenchmarkRegexRules(b *testing.B) {
+	for _, count := range benchmarkRuleCounts {
+		rules := benchmarkRules(count)
+		queries := benchmarkQueries(count, 1000)
+		matcher := NewRegexMatcher(rules)
+
+		b.Run(fmt.Sprintf("rules=%d/sequential", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				findRegexRuleSequentially(rules, queries[i%len(queries)])
+			}
+		})
+		b.Run(fmt.Sprintf("rules=%d/matcher", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				matcher.Find(queries[i%len(queries)], nil)
+			}
+		})
+	}
+}
+
+// benchmarkRules generates the rules of the kinds used in the configurations
+func benchmarkRules(count int) []RegexRule {
+	rules := make([]RegexRule, 0, count)
+	for i := 0; i < count; i++ {
+		var pattern string
+		switch i % 5 {
+		case 0:
+			pattern = fmt.Sprintf(`^SELECT .* FROM table_%d( |$).*`, i)
+		case 1:
+			pattern = fmt.Sprintf(`^(UPDATE|DELETE FROM) table_%d .*`, i)
+		case 2:
+			pattern = fmt.Sprintf(`(?i)^select .* from view_%d\b.*`, i)
+		case 3:
+			pattern = fmt.Sprintf(`FROM report_%d WHERE`, i)
+		default:
+			if i%20 == 4 {
+				// no literal prefix, checked for every query
+				pattern = fmt.Sprintf(`^[A-Z]+ .*archive_%d\b`, i)
+			} else {
+				pattern = fmt.Sprintf(`^INSERT INTO log_%d .*`, i)
+			}
+		}
+
+		rule := RegexRule{Index: i, Pattern: pattern}
+		rule.compile()
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// benchmarkQueries generates normalized queries, some of them don't match any rule
+func benchmarkQueries(ruleCount int, count int) []string {
+	random := rand.New(rand.NewSource(int64(ruleCount)))
+	templates := []string{
+		"SELECT * FROM table_%d WHERE id = ?",
+		"UPDATE table_%d SET name = ? WHERE id = ?",
+		"select a, b from view_%d where c = ?",
+		"SELECT COUNT ( * ) FROM report_%d WHERE day = ?",
+		"INSERT INTO log_%d ( a ) VALUES ( ? )",
+		"SELECT * FROM archive_%d",
+		"SELECT * FROM unknown_%d WHERE id = ?",
+	}
+
+	queries := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		template := templates[random.Intn(len(templates))]
+		queries = append(queries, fmt.Sprintf(template, random.Intn(ruleCount*2)))
+	}
+	return queries
+}
@@ -3,14 +3,17 @@ package redirect
 import (
 	"go-proxy/modules/config"
 	"regexp"
+	"time"
 )
 
 var (
-	RegexRules []RegexRule
+	RegexRules   []RegexRule
+	regexMatcher = NewRegexMatcher(nil)
 )
 
 type RegexRule struct {
 	Rule        config.Rule
+	Index       int // position of the rule in the configuration
 	Pattern     string
 	Regexp      *regexp.Regexp
 	TargetGroup string
@@ -26,10 +29,12 @@ func (regexRule *RegexRule) compile() {
 }
 
 func BuildRegexRules() {
-	for _, rule := range config.Config.Proxy.Rules {
+	RegexRules = nil
+	for i, rule := range config.Config.Proxy.Rules {
 		if rule.Regex != "" {
 			r := RegexRule{
 				Rule:        rule,
+				Index:       i,
 				Pattern:     rule.Regex,
 				TargetGroup: rule.Target,
 			}
@@ -37,14 +42,12 @@ func BuildRegexRules() {
 			RegexRules = append(RegexRules, r)
 		}
 	}
+	regexMatcher = NewRegexMatcher(RegexRules)
 }
 
-func FindRegexRule(query string) (RegexRule, bool) {
-	for _, regexRule := range RegexRules {
-		if regexRule.Match(query) {
-			return regexRule, true
-		}
-	}
-
-	return RegexRule{}, false
+// FindRegexRule finds the first regex rule active at the time that matches the query
+func FindRegexRule(query string, now time.Time) (RegexRule, bool) {
+	return regexMatcher.Find(query, func(rule RegexRule) bool {
+		return isRuleActive(rule.Index, now)
+	})
 }
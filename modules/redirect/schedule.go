@@ -0,0 +1,86 @@
+package redirect
+
+import (
+	"go-proxy/modules/cache"
+	"go-proxy/modules/config"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// scheduleWindow is the period in which the activity of none of the scheduled rules changes
+type scheduleWindow struct {
+	until time.Time // until is the first boundary of a window of the scheduled rules
+	key   string    // key is added to the cache keys of the routing decisions made in the period
+}
+
+var (
+	// schedules of the rules by their position in the configuration
+	schedules map[int]*config.Schedule
+	// current period of the schedules, recomputed when it ends
+	currentWindow atomic.Pointer[scheduleWindow]
+)
+
+func init() {
+	schedules = make(map[int]*config.Schedule)
+}
+
+// BuildSchedules parses the schedules of the rules
+func BuildSchedules() {
+	schedules = make(map[int]*config.Schedule)
+	for i, rule := range config.Config.Proxy.Rules {
+		if rule.Active == nil {
+			continue
+		}
+		// the schedules are validated with the configuration
+		if schedule, err := rule.Active.Parse(); err == nil {
+			schedules[i] = schedule
+		}
+	}
+	currentWindow.Store(nil)
+}
+
+// isRuleActive checks if the rule at the position can be used at the time
+func isRuleActive(index int, now time.Time) bool {
+	schedule, found := schedules[index]
+	return !found || schedule.IsActive(now)
+}
+
+// routingKey returns the cache key of the routing decision of the query. The key includes the fingerprint of the rules
+// and, with scheduled rules, the end of the current period so the decisions aren't used after the activity of the rules
+// changes. The returned ttl expires the decision at the end of the period, 0 if there are no scheduled rules.
+//
+// The decision depends only on the query and the rules, the session attributes (the schema routes of the database,
+// the routing hints allowed for the user) are applied by the proxy after the decision is read, so they aren't a part
+// of the key.
+func routingKey(hash string, now time.Time) (string, time.Duration) {
+	key := cache.RoutingKeyPrefix + rulesFingerprint + ":" + hash
+	if len(schedules) == 0 {
+		return key, 0
+	}
+
+	window := currentWindow.Load()
+	if window == nil || !now.Before(window.until) {
+		until := nextScheduleBoundary(now)
+		window = &scheduleWindow{until: until, key: strconv.FormatInt(until.Unix(), 10)}
+		currentWindow.Store(window)
+	}
+
+	return key + "@" + window.key, window.until.Sub(now)
+}
+
+// nextScheduleBoundary returns the first start or end of a window of any scheduled rule after the time
+func nextScheduleBoundary(now time.Time) time.Time {
+	var next time.Time
+	for _, schedule := range schedules {
+		if boundary := schedule.NextBoundary(now); !boundary.IsZero() && (next.IsZero() || boundary.Before(next)) {
+			next = boundary
+		}
+	}
+
+	if next.IsZero() {
+		// every window starts on one of its days within a week, without a boundary the period is rechecked daily
+		return now.Add(24 * time.Hour)
+	}
+	return next
+}
@@ -0,0 +1,35 @@
+package redirect
+
+import (
+	"go-proxy/modules/config"
+	"hash/fnv"
+	"math/rand"
+)
+
+// splitPrecision is the number of points the sticky keys are spread over, 0.01% per point
+const splitPrecision = 10000
+
+// ChooseSplit chooses the split of the rule, the sticky key (session ID or query digest) always gets the same split,
+// an empty key chooses at random
+func ChooseSplit(rule *config.Rule, stickyKey string) config.RuleSplit {
+	var point float64
+	if stickyKey == "" {
+		point = rand.Float64() * 100
+	} else {
+		hash := fnv.New64a()
+		hash.Write([]byte(rule.Name))
+		hash.Write([]byte(stickyKey))
+		point = float64(hash.Sum64()%splitPrecision) * 100 / splitPrecision
+	}
+
+	total := 0.0
+	for _, split := range rule.Split {
+		total += split.Percentage
+		if point < total {
+			return split
+		}
+	}
+
+	// rounding of the percentages
+	return rule.Split[len(rule.Split)-1]
+}
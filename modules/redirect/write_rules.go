@@ -0,0 +1,117 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"go-proxy/modules/config"
+	"go-proxy/modules/db/util"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// writeClauses make a SELECT a write (see util.IsWrite), the texts are lowercase
+var writeClauses = []string{"for update", "for share", "lock in share mode", " into "}
+
+// ValidateRules rejects the regex rules that match only writes but target a replica group, such rules would send
+// every matched query to the primary instead
+func ValidateRules() error {
+	var errs []error
+	for i, rule := range config.Config.Proxy.Rules {
+		if rule.Regex == "" || !isWriteOnlyPattern(rule.Regex) {
+			continue
+		}
+		for _, target := range rule.Targets() {
+			if group, err := config.GetServerGroup(target); err == nil && group.IsReplica() {
+				errs = append(errs, fmt.Errorf("[RULE %v ERROR] (%v): regex_rule matches only writes but targets the replica group %v", i+1, rule.Name, group.Id))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isWriteOnlyPattern checks if the regex can match only write statements: every alternative is anchored to
+// the beginning of the query and starts with a write command, or every match contains a clause making the SELECT
+// a write, e.g. ^SELECT .* FOR UPDATE
+func isWriteOnlyPattern(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	re = re.Simplify()
+
+	if prefixes, anchored, _ := literalPrefixes(re); anchored && len(prefixes) > 0 {
+		writeCommands := true
+		for _, prefix := range prefixes {
+			writeCommands = writeCommands && util.IsWriteCommand(firstWord(prefix))
+		}
+		if writeCommands {
+			return true
+		}
+	}
+
+	return containsLiteral(re, isWriteClause)
+}
+
+// containsLiteral checks if every match of the expression contains a literal accepted by the function
+func containsLiteral(re *syntax.Regexp, accept func(string) bool) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return accept(string(re.Rune))
+	case syntax.OpCapture, syntax.OpPlus:
+		return containsLiteral(re.Sub[0], accept)
+	case syntax.OpRepeat:
+		return re.Min >= 1 && containsLiteral(re.Sub[0], accept)
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !containsLiteral(sub, accept) {
+				return false
+			}
+		}
+		return len(re.Sub) > 0
+	case syntax.OpConcat:
+		for i, sub := range re.Sub {
+			if containsLiteral(sub, accept) {
+				return true
+			}
+			// the literal can be split by the parser, e.g. FOR (?:SHARE|UPDATE)
+			texts, _, _ := literalPrefixes(&syntax.Regexp{Op: syntax.OpConcat, Sub: re.Sub[i:]})
+			if len(texts) > 0 && allAccepted(texts, accept) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func allAccepted(texts []string, accept func(string) bool) bool {
+	for _, text := range texts {
+		if !accept(text) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWriteClause(literal string) bool {
+	lower := strings.ToLower(literal)
+	for _, clause := range writeClauses {
+		if strings.Contains(lower, clause) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstWord returns the leading letters of the text
+func firstWord(text string) string {
+	for i, r := range text {
+		if !unicode.IsLetter(r) {
+			return text[:i]
+		}
+	}
+	return text
+}
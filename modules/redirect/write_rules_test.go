@@ -0,0 +1,34 @@
+package redirect
+
+import "testing"
+
+func TestIsWriteOnlyPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`^INSERT INTO t .*`, true},
+		{`^(INSERT|UPDATE).*`, true},
+		{`^(UPDATE|DELETE FROM) table_1 .*`, true},
+		{`^SELECT .* FOR UPDATE`, true},
+		{`^SELECT .* FROM t FOR SHARE$`, true},
+		{`^SELECT .* LOCK IN SHARE MODE`, true},
+		{`^SELECT a INTO @a FROM t`, true},
+		{`(?i)^select .* for update`, true},
+		{`^SELECT.*`, false},
+		{`^SELECT .* FROM orders.*`, false},
+		{`^(INSERT|SELECT).*`, false},
+		{`INSERT INTO t`, true},
+		{`^SELECT .* FROM t WHERE a = 1`, false},
+		{`^SELECT .* (FOR UPDATE)?`, false},
+		{`^SELECT .* (FOR UPDATE|FOR SHARE)`, true},
+		{`^SELECT .* (FOR UPDATE|LIMIT 1)`, false},
+		{`[`, false},
+	}
+
+	for _, test := range tests {
+		if got := isWriteOnlyPattern(test.pattern); got != test.want {
+			t.Errorf("isWriteOnlyPattern(%q) = %v, want %v", test.pattern, got, test.want)
+		}
+	}
+}
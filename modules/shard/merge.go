@@ -0,0 +1,526 @@
+package shard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/DataDog/go-sqllexer"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/db/util"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrNotMergeable = errors.New("query can't be executed across shards")
+
+const (
+	aggregateCount = "COUNT"
+	aggregateSum   = "SUM"
+	aggregateMin   = "MIN"
+	aggregateMax   = "MAX"
+)
+
+var (
+	// mergeableAggregates are the aggregate functions whose partial results can be merged
+	mergeableAggregates = map[string]bool{
+		aggregateCount: true,
+		aggregateSum:   true,
+		aggregateMin:   true,
+		aggregateMax:   true,
+	}
+
+	// aggregateFunctions are all the aggregate functions, used to detect the ones that can't be merged
+	aggregateFunctions = map[string]bool{
+		aggregateCount: true, aggregateSum: true, aggregateMin: true, aggregateMax: true,
+		"AVG": true, "GROUP_CONCAT": true, "STD": true, "STDDEV": true, "STDDEV_POP": true, "STDDEV_SAMP": true,
+		"VARIANCE": true, "VAR_POP": true, "VAR_SAMP": true, "BIT_AND": true, "BIT_OR": true, "BIT_XOR": true,
+		"JSON_ARRAYAGG": true, "JSON_OBJECTAGG": true,
+	}
+
+	// unmergeableKeywords are the keywords of the queries whose results can't be merged
+	unmergeableKeywords = map[string]bool{
+		"DISTINCT": true, "DISTINCTROW": true, "GROUP": true, "HAVING": true, "UNION": true, "INTERSECT": true,
+		"EXCEPT": true, "SQL_CALC_FOUND_ROWS": true, "INTO": true, "WINDOW": true, "OVER": true,
+	}
+)
+
+// orderColumn is the column of the ORDER BY clause
+type orderColumn struct {
+	name     string // name of the column, empty if the position is used
+	position int    // 1-based position in the select list, 0 if the name is used
+	desc     bool
+}
+
+// MergePlan describes how the results of the query executed by several shards are merged
+type MergePlan struct {
+	aggregates []string      // aggregate function of every selected column, nil if the query doesn't aggregate
+	order      []orderColumn // ORDER BY columns
+	limit      int64         // LIMIT of the query, -1 if there is none
+}
+
+// PlanMerge checks if the results of the query can be merged and returns the plan of the merge, supported are plain
+// SELECTs with ORDER BY and LIMIT, or SELECTs of COUNT, SUM, MIN and MAX without GROUP BY
+func PlanMerge(tokens []sqllexer.Token) (*MergePlan, error) {
+	if len(tokens) == 0 || !isKeyword(tokens[0], "SELECT") {
+		return nil, fmt.Errorf("%w: only SELECT can be executed across shards", ErrNotMergeable)
+	}
+
+	plan := &MergePlan{limit: -1}
+	clauses := make(map[string]int)
+	depth := 0
+	for i, token := range tokens {
+		switch {
+		case token.Value == "(":
+			depth++
+		case token.Value == ")":
+			depth--
+		case (token.Type == sqllexer.IDENT || token.Type == sqllexer.FUNCTION) && unmergeableKeywords[strings.ToUpper(token.Value)]:
+			// DISTINCT(a) and OVER(...) are lexed as functions
+			return nil, fmt.Errorf("%w: %s is not supported", ErrNotMergeable, strings.ToUpper(token.Value))
+		case token.Type == sqllexer.IDENT && depth == 0:
+			keyword := strings.ToUpper(token.Value)
+			if _, found := clauses[keyword]; !found {
+				clauses[keyword] = i
+			}
+		}
+	}
+
+	selectEnd := len(tokens)
+	if from, found := clauses["FROM"]; found {
+		selectEnd = from
+	}
+	if err := plan.planAggregates(tokens[1:selectEnd]); err != nil {
+		return nil, err
+	}
+
+	limit, hasLimit := clauses["LIMIT"]
+	if order, found := clauses["ORDER"]; found {
+		orderEnd := len(tokens)
+		if hasLimit {
+			orderEnd = limit
+		}
+		if err := plan.planOrder(tokens[order:orderEnd]); err != nil {
+			return nil, err
+		}
+	}
+	if hasLimit {
+		if err := plan.planLimit(tokens[limit+1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// planAggregates reads the aggregate functions of the select list
+func (p *MergePlan) planAggregates(selectList []sqllexer.Token) error {
+	aggregates := make([]string, 0)
+	plain := 0
+	for _, item := range splitList(selectList) {
+		function, isAggregate := aggregateItem(item)
+		if isAggregate {
+			aggregates = append(aggregates, function)
+			continue
+		}
+		for j, token := range item {
+			if util.IsFunctionCall(item, j) && aggregateFunctions[strings.ToUpper(token.Value)] {
+				return fmt.Errorf("%w: %s can't be merged", ErrNotMergeable, strings.ToUpper(token.Value))
+			}
+		}
+		plain++
+	}
+
+	if len(aggregates) > 0 && plain > 0 {
+		return fmt.Errorf("%w: aggregates mixed with plain columns require GROUP BY", ErrNotMergeable)
+	}
+	if len(aggregates) > 0 {
+		p.aggregates = aggregates
+	}
+
+	return nil
+}
+
+// aggregateItem checks if the select list item is a mergeable aggregate, optionally followed by an alias. The name
+// is lexed as a function only when the parenthesis follows it directly, COUNT (*) is a call too.
+func aggregateItem(item []sqllexer.Token) (string, bool) {
+	if len(item) < 3 || !util.IsFunctionCall(item, 0) || item[1].Value != "(" {
+		return "", false
+	}
+
+	function := strings.ToUpper(item[0].Value)
+	if !mergeableAggregates[function] {
+		return "", false
+	}
+
+	// find the closing parenthesis, COUNT(DISTINCT ...) can't be merged
+	depth, end := 0, -1
+	for i := 1; i < len(item) && end == -1; i++ {
+		switch {
+		case item[i].Value == "(":
+			depth++
+		case item[i].Value == ")":
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		case isKeyword(item[i], "DISTINCT"):
+			return "", false
+		}
+	}
+	if end == -1 {
+		return "", false
+	}
+
+	// only an alias can follow
+	rest := item[end+1:]
+	if len(rest) > 0 && isKeyword(rest[0], "AS") {
+		rest = rest[1:]
+	}
+	if len(rest) > 1 || (len(rest) == 1 && rest[0].Type != sqllexer.IDENT && rest[0].Type != sqllexer.QUOTED_IDENT) {
+		return "", false
+	}
+
+	return function, true
+}
+
+// planOrder reads the ORDER BY clause, only columns and positions are supported
+func (p *MergePlan) planOrder(tokens []sqllexer.Token) error {
+	if len(tokens) < 3 || !isKeyword(tokens[1], "BY") {
+		return fmt.Errorf("%w: ORDER BY is invalid", ErrNotMergeable)
+	}
+
+	for _, item := range splitList(tokens[2:]) {
+		column := orderColumn{}
+		if len(item) == 2 && (isKeyword(item[1], "ASC") || isKeyword(item[1], "DESC")) {
+			column.desc = isKeyword(item[1], "DESC")
+			item = item[:1]
+		}
+		if len(item) != 1 {
+			return fmt.Errorf("%w: ORDER BY supports only columns", ErrNotMergeable)
+		}
+
+		switch item[0].Type {
+		case sqllexer.NUMBER:
+			position, err := strconv.Atoi(item[0].Value)
+			if err != nil || position < 1 {
+				return fmt.Errorf("%w: ORDER BY position is invalid", ErrNotMergeable)
+			}
+			column.position = position
+		case sqllexer.IDENT, sqllexer.QUOTED_IDENT:
+			column.name = columnName(item[0].Value)
+		default:
+			return fmt.Errorf("%w: ORDER BY supports only columns", ErrNotMergeable)
+		}
+		p.order = append(p.order, column)
+	}
+
+	return nil
+}
+
+// planLimit reads the LIMIT clause, offsets can't be merged
+func (p *MergePlan) planLimit(tokens []sqllexer.Token) error {
+	var limit, offset string
+	switch {
+	case len(tokens) == 1:
+		limit = tokens[0].Value
+	case len(tokens) == 3 && tokens[1].Value == ",":
+		offset, limit = tokens[0].Value, tokens[2].Value
+	case len(tokens) == 3 && isKeyword(tokens[1], "OFFSET"):
+		limit, offset = tokens[0].Value, tokens[2].Value
+	default:
+		return fmt.Errorf("%w: LIMIT is invalid", ErrNotMergeable)
+	}
+
+	if offset != "" && offset != "0" {
+		return fmt.Errorf("%w: LIMIT with offset is not supported", ErrNotMergeable)
+	}
+
+	value, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil || value < 0 {
+		return fmt.Errorf("%w: LIMIT is invalid", ErrNotMergeable)
+	}
+	p.limit = value
+
+	return nil
+}
+
+// Merge merges the results returned by the shards
+func (p *MergePlan) Merge(results []*mysql.Result) (*mysql.Result, error) {
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: no results", ErrNotMergeable)
+	}
+
+	base := results[0]
+	for _, result := range results {
+		if result == nil || result.Resultset == nil || len(result.Fields) != len(base.Fields) {
+			return nil, fmt.Errorf("%w: shards returned different results", ErrNotMergeable)
+		}
+	}
+
+	var rows []mysql.RowData
+	var err error
+	if p.aggregates != nil {
+		rows, err = p.mergeAggregates(base.Fields, results)
+	} else {
+		rows, err = p.mergeRows(base.Fields, results)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]mysql.FieldValue, len(rows))
+	for i, row := range rows {
+		if values[i], err = row.ParseText(base.Fields, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &mysql.Result{
+		Status: base.Status,
+		Resultset: &mysql.Resultset{
+			Fields:     base.Fields,
+			FieldNames: base.FieldNames,
+			Values:     values,
+			RowDatas:   rows,
+		},
+	}, nil
+}
+
+// mergeRows concatenates the rows, sorts them and applies the limit
+func (p *MergePlan) mergeRows(fields []*mysql.Field, results []*mysql.Result) ([]mysql.RowData, error) {
+	type sortableRow struct {
+		data  mysql.RowData
+		cells [][]byte
+	}
+
+	columns := make([]int, len(p.order))
+	for i, column := range p.order {
+		index, err := resolveColumn(fields, column)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = index
+	}
+
+	rows := make([]sortableRow, 0)
+	for _, result := range results {
+		for _, data := range result.RowDatas {
+			cells, err := splitTextRow(data, len(fields))
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, sortableRow{data: data, cells: cells})
+		}
+	}
+
+	if len(columns) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for k, column := range columns {
+				c := compareCells(fields[column], rows[i].cells[column], rows[j].cells[column])
+				if c == 0 {
+					continue
+				}
+				if p.order[k].desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if p.limit >= 0 && int64(len(rows)) > p.limit {
+		rows = rows[:p.limit]
+	}
+
+	merged := make([]mysql.RowData, len(rows))
+	for i, row := range rows {
+		merged[i] = row.data
+	}
+	return merged, nil
+}
+
+// mergeAggregates merges the single rows returned by the shards into one row
+func (p *MergePlan) mergeAggregates(fields []*mysql.Field, results []*mysql.Result) ([]mysql.RowData, error) {
+	merged := make([][]byte, len(fields))
+	for column := range fields {
+		var sum *big.Rat
+		var chosen []byte
+		scale := 0
+		for _, result := range results {
+			for _, data := range result.RowDatas {
+				cells, err := splitTextRow(data, len(fields))
+				if err != nil {
+					return nil, err
+				}
+				cell := cells[column]
+				if cell == nil {
+					continue
+				}
+
+				switch p.aggregates[column] {
+				case aggregateCount, aggregateSum:
+					value, ok := new(big.Rat).SetString(string(cell))
+					if !ok {
+						return nil, fmt.Errorf("%w: %s returned a non-numeric value", ErrNotMergeable, p.aggregates[column])
+					}
+					if sum == nil {
+						sum = new(big.Rat)
+					}
+					if dot := bytes.IndexByte(cell, '.'); dot != -1 {
+						scale = max(scale, len(cell)-dot-1)
+					}
+					sum.Add(sum, value)
+				case aggregateMin:
+					if chosen == nil || compareCells(fields[column], cell, chosen) < 0 {
+						chosen = cell
+					}
+				case aggregateMax:
+					if chosen == nil || compareCells(fields[column], cell, chosen) > 0 {
+						chosen = cell
+					}
+				}
+			}
+		}
+
+		if sum != nil {
+			chosen = formatSum(fields[column], sum, scale)
+		}
+		merged[column] = chosen
+	}
+
+	row := make([]byte, 0)
+	for _, cell := range merged {
+		if cell == nil {
+			row = append(row, 0xfb)
+			continue
+		}
+		row = append(row, mysql.PutLengthEncodedString(cell)...)
+	}
+
+	return []mysql.RowData{row}, nil
+}
+
+// resolveColumn finds the index of the ORDER BY column in the result
+func resolveColumn(fields []*mysql.Field, column orderColumn) (int, error) {
+	if column.position > 0 {
+		if column.position > len(fields) {
+			return 0, fmt.Errorf("%w: ORDER BY position %d is out of range", ErrNotMergeable, column.position)
+		}
+		return column.position - 1, nil
+	}
+
+	for i, field := range fields {
+		if strings.EqualFold(string(field.Name), column.name) {
+			return i, nil
+		}
+	}
+	for i, field := range fields {
+		if strings.EqualFold(string(field.OrgName), column.name) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: ORDER BY column %s has to be selected", ErrNotMergeable, column.name)
+}
+
+// splitTextRow splits the text protocol row into cells, NULL cells are nil
+func splitTextRow(data mysql.RowData, columns int) ([][]byte, error) {
+	cells := make([][]byte, columns)
+	pos := 0
+	for i := 0; i < columns; i++ {
+		value, isNull, n, err := mysql.LengthEncodedString(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if !isNull {
+			cells[i] = value
+			if cells[i] == nil {
+				cells[i] = []byte{}
+			}
+		}
+	}
+	return cells, nil
+}
+
+// compareCells compares two values of the field, NULLs are the lowest, numbers are compared numerically
+// and everything else byte by byte
+func compareCells(field *mysql.Field, a []byte, b []byte) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if isNumericField(field) {
+		x, xOk := new(big.Rat).SetString(string(a))
+		y, yOk := new(big.Rat).SetString(string(b))
+		if xOk && yOk {
+			return x.Cmp(y)
+		}
+	}
+
+	return bytes.Compare(a, b)
+}
+
+// formatSum formats the merged sum the way the server formats the field, scale is the largest number of decimal
+// digits of the partial sums
+func formatSum(field *mysql.Field, sum *big.Rat, scale int) []byte {
+	switch field.Type {
+	case mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_DOUBLE:
+		value, _ := sum.Float64()
+		return []byte(strconv.FormatFloat(value, 'g', -1, 64))
+	default:
+		return []byte(sum.FloatString(scale))
+	}
+}
+
+func isNumericField(field *mysql.Field) bool {
+	switch field.Type {
+	case mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_SHORT,
+		mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_FLOAT,
+		mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_YEAR:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitList splits the tokens by the commas outside of parentheses
+func splitList(tokens []sqllexer.Token) [][]sqllexer.Token {
+	items := make([][]sqllexer.Token, 0)
+	depth, start := 0, 0
+	for i, token := range tokens {
+		switch {
+		case token.Value == "(":
+			depth++
+		case token.Value == ")":
+			depth--
+		case token.Value == "," && depth == 0:
+			items = append(items, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		items = append(items, tokens[start:])
+	}
+	return items
+}
+
+// columnName removes the table qualifier and the quotes from the column
+func columnName(name string) string {
+	if index := strings.LastIndex(name, "."); index != -1 {
+		name = name[index+1:]
+	}
+	return strings.Trim(name, "`\"")
+}
+
+func isKeyword(token sqllexer.Token, keyword string) bool {
+	return token.Type == sqllexer.IDENT && strings.EqualFold(token.Value, keyword)
+}
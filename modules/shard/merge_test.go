@@ -0,0 +1,171 @@
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go-proxy/modules/db/util"
+	"reflect"
+	"testing"
+)
+
+func TestPlanMerge(t *testing.T) {
+	tests := []struct {
+		query      string
+		aggregates []string
+		order      []orderColumn
+		limit      int64
+		mergeable  bool
+	}{
+		{"SELECT a, b FROM t", nil, nil, -1, true},
+		{"SELECT a FROM t ORDER BY a DESC, 2 LIMIT 10", nil, []orderColumn{{name: "a", desc: true}, {position: 2}}, 10, true},
+		{"SELECT a FROM t LIMIT 0, 5", nil, nil, 5, true},
+		{"SELECT COUNT(*) FROM t", []string{"COUNT"}, nil, -1, true},
+		{"SELECT COUNT (*) FROM t", []string{"COUNT"}, nil, -1, true},
+		{"SELECT SUM (a) AS s, min(b), MAX (c) m FROM t WHERE d IN (1, 2)", []string{"SUM", "MIN", "MAX"}, nil, -1, true},
+		{"SELECT AVG(a) FROM t", nil, nil, 0, false},
+		{"SELECT AVG (a) FROM t", nil, nil, 0, false},
+		{"SELECT GROUP_CONCAT (a) FROM t", nil, nil, 0, false},
+		{"SELECT COUNT(a) + 1 FROM t", nil, nil, 0, false},
+		{"SELECT COUNT(DISTINCT a) FROM t", nil, nil, 0, false},
+		{"SELECT DISTINCT(a) FROM t", nil, nil, 0, false},
+		{"SELECT a, COUNT(*) FROM t GROUP BY a", nil, nil, 0, false},
+		{"SELECT a, COUNT (*) FROM t", nil, nil, 0, false},
+		{"SELECT SUM(a) OVER(PARTITION BY b) FROM t", nil, nil, 0, false},
+		{"SELECT a FROM t LIMIT 10 OFFSET 5", nil, nil, 0, false},
+		{"SELECT a FROM t ORDER BY a + 1", nil, nil, 0, false},
+		{"UPDATE t SET a = 1", nil, nil, 0, false},
+	}
+
+	for _, test := range tests {
+		plan, err := PlanMerge(util.Tokenize(test.query))
+		if !test.mergeable {
+			if !errors.Is(err, ErrNotMergeable) {
+				t.Errorf("PlanMerge(%q) error = %v, want ErrNotMergeable", test.query, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("PlanMerge(%q) error = %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(plan.aggregates, test.aggregates) || !reflect.DeepEqual(plan.order, test.order) || plan.limit != test.limit {
+			t.Errorf("PlanMerge(%q) = %+v, want aggregates %v, order %v, limit %d", test.query, *plan, test.aggregates, test.order, test.limit)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ints := []*mysql.Field{{Name: []byte("a"), Type: mysql.MYSQL_TYPE_LONGLONG}, {Name: []byte("b"), Type: mysql.MYSQL_TYPE_VAR_STRING}}
+	aggregates := []*mysql.Field{
+		{Name: []byte("c"), Type: mysql.MYSQL_TYPE_LONGLONG},
+		{Name: []byte("s"), Type: mysql.MYSQL_TYPE_NEWDECIMAL},
+		{Name: []byte("lo"), Type: mysql.MYSQL_TYPE_LONG},
+		{Name: []byte("hi"), Type: mysql.MYSQL_TYPE_VAR_STRING},
+	}
+
+	tests := []struct {
+		query   string
+		results []*mysql.Result
+		rows    [][]interface{}
+	}{
+		{
+			"SELECT COUNT(*) AS c, SUM (s), MIN(lo), MAX(hi) FROM t",
+			[]*mysql.Result{
+				textResult(aggregates, []interface{}{3, "1.50", 9, "b"}),
+				textResult(aggregates, []interface{}{4, "2.5", 10, "c"}),
+				textResult(aggregates, []interface{}{0, nil, nil, nil}),
+			},
+			[][]interface{}{{"7", "4.00", "9", "c"}},
+		},
+		{
+			// every shard had no rows
+			"SELECT COUNT(*), SUM(s), MIN(lo), MAX(hi) FROM t",
+			[]*mysql.Result{
+				textResult(aggregates, []interface{}{0, nil, nil, nil}),
+				textResult(aggregates, []interface{}{0, nil, nil, nil}),
+			},
+			[][]interface{}{{"0", nil, nil, nil}},
+		},
+		{
+			"SELECT a, b FROM t ORDER BY a DESC LIMIT 3",
+			[]*mysql.Result{
+				textResult(ints, []interface{}{10, "x"}, []interface{}{2, "y"}),
+				textResult(ints, []interface{}{9, "z"}, []interface{}{nil, "n"}),
+				textResult(ints),
+			},
+			[][]interface{}{{"10", "x"}, {"9", "z"}, {"2", "y"}},
+		},
+		{
+			// NULLs are the lowest, numbers aren't compared as text
+			"SELECT a, b FROM t ORDER BY 1",
+			[]*mysql.Result{
+				textResult(ints, []interface{}{10, "x"}, []interface{}{nil, "n"}),
+				textResult(ints, []interface{}{9, "z"}),
+			},
+			[][]interface{}{{nil, "n"}, {"9", "z"}, {"10", "x"}},
+		},
+		{
+			"SELECT a, b FROM t ORDER BY b LIMIT 0",
+			[]*mysql.Result{textResult(ints, []interface{}{1, "x"})},
+			[][]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		plan, err := PlanMerge(util.Tokenize(test.query))
+		if err != nil {
+			t.Fatalf("PlanMerge(%q) error = %v", test.query, err)
+		}
+		merged, err := plan.Merge(test.results)
+		if err != nil {
+			t.Errorf("Merge of %q error = %v", test.query, err)
+			continue
+		}
+
+		rows := make([][]interface{}, 0)
+		for _, data := range merged.RowDatas {
+			cells, err := splitTextRow(data, len(merged.Fields))
+			if err != nil {
+				t.Fatal(err)
+			}
+			row := make([]interface{}, len(cells))
+			for i, cell := range cells {
+				if cell != nil {
+					row[i] = string(cell)
+				}
+			}
+			rows = append(rows, row)
+		}
+		if !reflect.DeepEqual(rows, test.rows) {
+			t.Errorf("Merge of %q = %v, want %v", test.query, rows, test.rows)
+		}
+	}
+}
+
+func TestMergeDifferentResults(t *testing.T) {
+	plan, _ := PlanMerge(util.Tokenize("SELECT a FROM t"))
+	one := []*mysql.Field{{Name: []byte("a")}}
+	two := []*mysql.Field{{Name: []byte("a")}, {Name: []byte("b")}}
+	if _, err := plan.Merge([]*mysql.Result{textResult(one), textResult(two)}); !errors.Is(err, ErrNotMergeable) {
+		t.Errorf("Merge of different results error = %v, want ErrNotMergeable", err)
+	}
+}
+
+// textResult builds the result of the text protocol, nil values are NULLs
+func textResult(fields []*mysql.Field, rows ...[]interface{}) *mysql.Result {
+	data := make([]mysql.RowData, 0, len(rows))
+	for _, row := range rows {
+		var encoded []byte
+		for _, value := range row {
+			if value == nil {
+				encoded = append(encoded, 0xfb)
+				continue
+			}
+			encoded = append(encoded, mysql.PutLengthEncodedString([]byte(fmt.Sprint(value)))...)
+		}
+		data = append(data, encoded)
+	}
+
+	return &mysql.Result{Resultset: &mysql.Resultset{Fields: fields, RowDatas: data}}
+}
@@ -0,0 +1,170 @@
+// Package shard resolves the server groups of sharded queries using the shard maps from the configuration.
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DataDog/go-sqllexer"
+	"go-proxy/modules/config"
+	"go-proxy/modules/db/util"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrKeyNotFound      = errors.New("sharding key not found in the query")
+	ErrKeyBound         = errors.New("sharding key is a bound parameter")
+	ErrMultipleShards   = errors.New("query spans multiple shards")
+	ErrMapNotFound      = errors.New("shard map not found")
+	ErrKeyAssigned      = errors.New("sharding key can't be changed, the row would stay on the shard of the old value")
+	ErrTransactionShard = errors.New("transaction can't span multiple shards")
+)
+
+// Map maps the values of the sharding key to the server groups
+type Map struct {
+	Config config.ShardMap
+}
+
+var (
+	Maps map[string]*Map
+)
+
+func init() {
+	Maps = make(map[string]*Map)
+}
+
+// BuildMaps builds the shard maps from the configuration
+func BuildMaps() {
+	Maps = make(map[string]*Map)
+	for _, shardMap := range config.Config.Proxy.ShardMaps {
+		Maps[shardMap.Name] = &Map{Config: shardMap}
+	}
+}
+
+// GetMap returns the shard map with the given name
+func GetMap(name string) (*Map, error) {
+	shardMap, found := Maps[name]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrMapNotFound, name)
+	}
+	return shardMap, nil
+}
+
+// GroupFor returns the group the key belongs to
+func (m *Map) GroupFor(key string) (string, error) {
+	switch m.Config.Type {
+	case config.ShardMapHash:
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		return m.Config.Groups[hash.Sum32()%uint32(len(m.Config.Groups))], nil
+	case config.ShardMapRange:
+		value, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("key %q of the range shard map %s is not an integer", key, m.Config.Name)
+		}
+		for _, shardRange := range m.Config.Ranges {
+			if shardRange.Contains(value) {
+				return shardRange.Group, nil
+			}
+		}
+		return "", fmt.Errorf("key %d is outside of the ranges of the shard map %s", value, m.Config.Name)
+	default:
+		return "", fmt.Errorf("shard map %s has unsupported type %s", m.Config.Name, m.Config.Type)
+	}
+}
+
+// AnyGroup returns the first group of the map, used when every shard can handle the request (e.g. prepare)
+func (m *Map) AnyGroup() string {
+	if m.Config.Type == config.ShardMapRange {
+		return m.Config.Ranges[0].Group
+	}
+	return m.Config.Groups[0]
+}
+
+// Groups returns every group of the map
+func (m *Map) Groups() []string {
+	if m.Config.Type != config.ShardMapRange {
+		return m.Config.Groups
+	}
+
+	groups := make([]string, 0, len(m.Config.Ranges))
+	seen := make(map[string]bool)
+	for _, shardRange := range m.Config.Ranges {
+		if !seen[shardRange.Group] {
+			seen[shardRange.Group] = true
+			groups = append(groups, shardRange.Group)
+		}
+	}
+	return groups
+}
+
+// ResolveGroups returns the distinct groups of the sharding key values found in the query, args are the bound
+// parameters of the prepared statement, they are nil if the statement isn't executed yet
+func ResolveGroups(rule config.RuleShard, tokens []sqllexer.Token, args []interface{}) ([]string, error) {
+	shardMap, err := GetMap(rule.Map)
+	if err != nil {
+		return nil, err
+	}
+
+	if util.AssignsColumn(tokens, rule.Key) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyAssigned, rule.Key)
+	}
+
+	values, found := util.ExtractColumnValues(tokens, rule.Key)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, rule.Key)
+	}
+
+	groups := make([]string, 0, 1)
+	seen := make(map[string]bool)
+	for _, value := range values {
+		key := value.Value
+		if value.IsParameter() {
+			if args == nil {
+				return nil, fmt.Errorf("%w: %s", ErrKeyBound, rule.Key)
+			}
+			if value.Parameter >= len(args) {
+				return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, rule.Key)
+			}
+			key = formatArg(args[value.Parameter])
+		}
+
+		group, err := shardMap.GroupFor(key)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+// ResolveGroup returns the group of the query, the query has to target exactly one shard
+func ResolveGroup(rule config.RuleShard, tokens []sqllexer.Token, args []interface{}) (string, error) {
+	groups, err := ResolveGroups(rule, tokens, args)
+	if err != nil {
+		return "", err
+	}
+
+	if len(groups) > 1 {
+		return "", fmt.Errorf("%w: %s", ErrMultipleShards, strings.Join(groups, ", "))
+	}
+
+	return groups[0], nil
+}
+
+// formatArg formats the bound parameter the same way it would be written as a literal
+func formatArg(arg interface{}) string {
+	switch value := arg.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"context"
+	"go-proxy/modules/log"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportInterval how often the collected metrics are written to the log
+const reportInterval = time.Minute
+
+// Timing aggregates the observed durations of one metric
+type Timing struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Average returns the average observed duration
+func (t Timing) Average() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+var (
+	mu       sync.Mutex
+	counters = make(map[string]int64)
+	timings  = make(map[string]Timing)
+)
+
+// Inc increments the counter, labels are given as key value pairs
+func Inc(name string, labels ...string) {
+	Add(name, 1, labels...)
+}
+
+// Add adds the value to the counter, labels are given as key value pairs
+func Add(name string, value int64, labels ...string) {
+	key := metricKey(name, labels)
+
+	mu.Lock()
+	defer mu.Unlock()
+	counters[key] += value
+}
+
+// Observe records the duration, labels are given as key value pairs
+func Observe(name string, duration time.Duration, labels ...string) {
+	key := metricKey(name, labels)
+
+	mu.Lock()
+	defer mu.Unlock()
+	timing := timings[key]
+	timing.Count++
+	timing.Total += duration
+	if duration > timing.Max {
+		timing.Max = duration
+	}
+	timings[key] = timing
+}
+
+// Snapshot returns the copy of the collected metrics
+func Snapshot() (map[string]int64, map[string]Timing) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	countersCopy := make(map[string]int64, len(counters))
+	for key, value := range counters {
+		countersCopy[key] = value
+	}
+	timingsCopy := make(map[string]Timing, len(timings))
+	for key, value := range timings {
+		timingsCopy[key] = value
+	}
+
+	return countersCopy, timingsCopy
+}
+
+// Report writes the collected metrics to the log until the context is canceled
+func Report(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				logSnapshot()
+			}
+		}
+	}()
+}
+
+func logSnapshot() {
+	countersSnapshot, timingsSnapshot := Snapshot()
+
+	for _, key := range sortedKeys(countersSnapshot) {
+		log.Logger.Info("Metric", zap.String("name", key), zap.Int64("value", countersSnapshot[key]))
+	}
+	for _, key := range sortedKeys(timingsSnapshot) {
+		timing := timingsSnapshot[key]
+		log.Logger.Info(
+			"Metric",
+			zap.String("name", key),
+			zap.Int64("count", timing.Count),
+			zap.Duration("avg", timing.Average()),
+			zap.Duration("max", timing.Max),
+		)
+	}
+}
+
+// metricKey builds the key of the metric in form name{key=value,...}
+func metricKey(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+labels[i+1])
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}